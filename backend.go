@@ -6,6 +6,7 @@ import (
 
 	"sync"
 
+	"github.com/hashicorp/vault/helper/salt"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
 )
@@ -41,38 +42,52 @@ func FactoryType(backendType logical.BackendType) logical.Factory {
 // Backend returns a private embedded struct of framework.Backend.
 func Backend() *backend {
 	var b backend
+	b.destinations = make(map[string]*Destination)
+	b.signingKeys = make(map[string]*parsedJwsKeyRing)
 	b.Backend = &framework.Backend{
 		Help: strings.TrimSpace(backendHelp),
 
 		PathsSpecial: &logical.Paths{
 			Unauthenticated: []string{
-				"keys/jws/certificate",
+				"keys/jws/*",
 				"keys/client/certificate",
+				"document/schema",
+				"document/schema/*",
 			},
 
 			LocalStorage: []string{
 				"verify/",
 			},
 			SealWrapStorage: []string{
-				"config/keys/jws",
+				"config/keys/jws/",
 				"config/keys/client",
+				"config/secrets/",
 			},
 		},
 
 		Paths: []*framework.Path{
-			pathConfigJws(&b),
+			pathListJws(&b),
+			pathRotateJws(&b),
+			pathGenerateJws(&b),
+			pathConfigJwsVersions(&b),
+			pathConfigJwsVersion(&b),
+			pathConfigJws(&b), // after the paths above, whose last segment would otherwise match key_name
 			pathFetchJwsCertificate(&b),
+			pathFetchJwks(&b),
 			//pathConfigClient(&b),
 			pathConfigDestination(&b),
 			pathConfigDestinations(&b),
 			pathDestination(&b),
 			pathVerify(&b),
+			pathDocumentSchemas(&b),
+			pathDocumentSchema(&b),
 			//pathFetchClientCertificate(&b),
 		},
 
 		//Secrets:     []*framework.Secret{},
-		//Invalidate:  b.invalidate,
-		BackendType: logical.TypeLogical,
+		Invalidate:   b.invalidate,
+		PeriodicFunc: b.periodicFunc,
+		BackendType:  logical.TypeLogical,
 	}
 
 	return &b
@@ -81,6 +96,16 @@ func Backend() *backend {
 type backend struct {
 	*framework.Backend
 	Lock sync.RWMutex
+
+	// cacheLock guards the caches of configuration parsed from storage. Requests fill
+	// them while only holding Lock for reading.
+	cacheLock    sync.RWMutex
+	destinations map[string]*Destination
+	signingKeys  map[string]*parsedJwsKeyRing
+	salt         *salt.Salt
+	// cacheGeneration is bumped by every invalidation, so a fill that read storage before
+	// one can tell its result may be stale.
+	cacheGeneration uint64
 }
 
 const backendHelp = `
@@ -0,0 +1,78 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"text/template"
+
+	"github.com/hashicorp/errwrap"
+)
+
+const defaultBodyContentType = "application/json"
+
+// bodyTemplateFuncs are available to body templates on top of the text/template builtins.
+var bodyTemplateFuncs = template.FuncMap{
+	// json encodes a value as JSON, so parameters can be placed in a JSON body safely:
+	// {"text": {{json .params.message}}}
+	"json": func(v interface{}) (string, error) {
+		buf, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return string(buf), nil
+	},
+}
+
+// parseBodyTemplate compiles a body template. It is only executed once a real document
+// is sent, where a key the document lacks is an error rather than "<no value>".
+func parseBodyTemplate(text string) (*template.Template, error) {
+	return template.New("body_template").Funcs(bodyTemplateFuncs).Option("missingkey=error").Parse(text)
+}
+
+// executeBodyTemplate renders the template with the document as it would be sent, so
+// fields are named as in JSON: .params, .metadata, .entity and so on.
+func executeBodyTemplate(tmpl *template.Template, doc Document) ([]byte, error) {
+	buf, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(buf))
+	decoder.UseNumber()
+
+	var data map[string]interface{}
+	if err := decoder.Decode(&data); err != nil {
+		return nil, err
+	}
+
+	var body bytes.Buffer
+	if err := tmpl.Execute(&body, data); err != nil {
+		return nil, err
+	}
+	return body.Bytes(), nil
+}
+
+// renderBody returns the destination's templated body and its content type. JSON bodies
+// are also checked, since a hand written template can easily produce broken JSON.
+func (d *Destination) renderBody(doc Document) ([]byte, http.Header, error) {
+	body, err := executeBodyTemplate(d.bodyTemplate, doc)
+	if err != nil {
+		return nil, nil, errwrap.Wrapf("could not render body_template: {{err}}", err)
+	}
+
+	contentType := d.bodyContentType()
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") {
+		if !json.Valid(body) {
+			return nil, nil, fmt.Errorf("body_template did not render valid JSON")
+		}
+	}
+
+	headers := http.Header{}
+	headers.Set("Content-Type", contentType)
+
+	return body, headers, nil
+}
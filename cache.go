@@ -0,0 +1,168 @@
+package webhook
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/helper/salt"
+	"github.com/hashicorp/vault/logical"
+)
+
+// destinationConfigPrefix is where destinations are stored, keyed by name.
+const destinationConfigPrefix = "config/destination/"
+
+// jwsKeyConfigPrefix covers every key ring, named or not, and the legacy key pair.
+const jwsKeyConfigPrefix = "config/keys/jws/"
+
+// getDestination returns the named destination, from the cache when possible. The returned
+// destination is shared and must not be modified. Returns nil if it does not exist.
+func (b *backend) getDestination(ctx context.Context, s logical.Storage, name string) (*Destination, error) {
+	b.cacheLock.RLock()
+	d, ok := b.destinations[name]
+	generation := b.cacheGeneration
+	b.cacheLock.RUnlock()
+	if ok {
+		return d, nil
+	}
+
+	entry, err := s.Get(ctx, destinationConfigPrefix+name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	d, err = entryToDestination(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	b.cacheLock.Lock()
+	// An invalidation while storage was read may have dropped a newer entry than d.
+	if b.cacheGeneration == generation {
+		b.destinations[name] = d
+	}
+	b.cacheLock.Unlock()
+
+	return d, nil
+}
+
+// parsedJwsKeyRing holds the published versions of a JWS key, parsed and ready to sign with.
+type parsedJwsKeyRing struct {
+	// keys are newest first, so the current key is keys[0].
+	keys     []*parsedJwsKey
+	dualSign bool
+}
+
+// current returns the key new documents are signed with.
+func (r *parsedJwsKeyRing) current() *parsedJwsKey {
+	return r.keys[0]
+}
+
+// signers returns the keys a document is signed with: the current key and, when dual
+// signing, any rotated-out key still inside its grace period.
+func (r *parsedJwsKeyRing) signers(now time.Time) []*parsedJwsKey {
+	if !r.dualSign {
+		return r.keys[:1]
+	}
+
+	var keys []*parsedJwsKey
+	for _, key := range r.keys {
+		if key.retireTime.IsZero() || now.Before(key.retireTime) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// getSigningKeys returns the published versions of the named JWS key with their PEM
+// already parsed, from the cache when possible. Returns nil if the key is not configured.
+func (b *backend) getSigningKeys(ctx context.Context, s logical.Storage, name string) (*parsedJwsKeyRing, error) {
+	b.cacheLock.RLock()
+	parsed, ok := b.signingKeys[name]
+	generation := b.cacheGeneration
+	b.cacheLock.RUnlock()
+	if ok {
+		return parsed, nil
+	}
+
+	ring, err := getJwsKeyRing(ctx, s, name)
+	if err != nil {
+		return nil, err
+	}
+	if ring == nil {
+		return nil, nil
+	}
+
+	published := ring.published(time.Now())
+	parsed = &parsedJwsKeyRing{dualSign: ring.DualSign}
+	for i := len(published) - 1; i >= 0; i-- {
+		// A key published ahead of an automatic rotation doesn't sign until it is current.
+		if published[i].Version > ring.LatestVersion {
+			continue
+		}
+		key, err := published[i].parse()
+		if err != nil {
+			return nil, err
+		}
+		parsed.keys = append(parsed.keys, key)
+	}
+
+	b.cacheLock.Lock()
+	if b.cacheGeneration == generation {
+		b.signingKeys[name] = parsed
+	}
+	b.cacheLock.Unlock()
+
+	return parsed, nil
+}
+
+// getSalt returns the mount's salt, used to HMAC values that identify a caller without
+// revealing them. The salt is created on first use.
+func (b *backend) getSalt(ctx context.Context, s logical.Storage) (*salt.Salt, error) {
+	b.cacheLock.RLock()
+	sa := b.salt
+	b.cacheLock.RUnlock()
+	if sa != nil {
+		return sa, nil
+	}
+
+	b.cacheLock.Lock()
+	defer b.cacheLock.Unlock()
+	if b.salt != nil {
+		return b.salt, nil
+	}
+
+	sa, err := salt.NewSalt(ctx, s, &salt.Config{
+		HashFunc: salt.SHA256Hash,
+		Location: salt.DefaultLocation,
+	})
+	if err != nil {
+		return nil, err
+	}
+	b.salt = sa
+
+	return sa, nil
+}
+
+// invalidate drops cached configuration when the storage entry behind it changes. Vault
+// calls it on performance standbys and replicas; handlers call it after their own writes.
+func (b *backend) invalidate(ctx context.Context, key string) {
+	b.cacheLock.Lock()
+	defer b.cacheLock.Unlock()
+
+	b.cacheGeneration++
+
+	switch {
+	case strings.HasPrefix(key, destinationConfigPrefix):
+		delete(b.destinations, strings.TrimPrefix(key, destinationConfigPrefix))
+	case strings.HasPrefix(key, jwsKeyConfigPrefix):
+		// Key rings are few and rarely written, and the legacy entries don't map to a
+		// single name, so every key is dropped.
+		b.signingKeys = make(map[string]*parsedJwsKeyRing)
+	case key == salt.DefaultLocation:
+		b.salt = nil
+	}
+}
@@ -0,0 +1,100 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+// racingStorage runs afterGet once, right after the next Get has read storage, standing
+// in for a write and invalidation that land before the caller caches what it read.
+type racingStorage struct {
+	logical.Storage
+	afterGet func()
+}
+
+func (s *racingStorage) Get(ctx context.Context, key string) (*logical.StorageEntry, error) {
+	entry, err := s.Storage.Get(ctx, key)
+	if s.afterGet != nil {
+		afterGet := s.afterGet
+		s.afterGet = nil
+		afterGet()
+	}
+	return entry, err
+}
+
+func putTestDestination(t *testing.T, s logical.Storage, name, targetURL string) {
+	buf, err := json.Marshal(&Destination{TargetURL: targetURL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(context.Background(), &logical.StorageEntry{Key: destinationConfigPrefix + name, Value: buf}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func putTestJwsKeyRing(t *testing.T, s logical.Storage, name string) *jwsKey {
+	privKey, certificate, err := generateKeyPair("ec", 0, "P-256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ring := &jwsKeyRing{GracePeriod: defaultJwsGracePeriod}
+	key, err := ring.addKey(certificate, privKey, "ES256", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := putJwsKeyRing(context.Background(), s, name, ring); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestGetDestinationInvalidatedWhileReading(t *testing.T) {
+	ctx := context.Background()
+	b := Backend()
+	s := &racingStorage{Storage: &logical.InmemStorage{}}
+	putTestDestination(t, s, "target", "https://old.example.com")
+
+	s.afterGet = func() {
+		putTestDestination(t, s, "target", "https://new.example.com")
+		b.invalidate(ctx, destinationConfigPrefix+"target")
+	}
+	if _, err := b.getDestination(ctx, s, "target"); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := b.getDestination(ctx, s, "target")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.TargetURL != "https://new.example.com" {
+		t.Errorf("got stale target_url %s", d.TargetURL)
+	}
+}
+
+func TestGetSigningKeysInvalidatedWhileReading(t *testing.T) {
+	ctx := context.Background()
+	b := Backend()
+	s := &racingStorage{Storage: &logical.InmemStorage{}}
+	putTestJwsKeyRing(t, s, "named")
+
+	var replaced *jwsKey
+	s.afterGet = func() {
+		replaced = putTestJwsKeyRing(t, s, "named")
+		b.invalidate(ctx, jwsKeyRingStoragePath("named"))
+	}
+	if _, err := b.getSigningKeys(ctx, s, "named"); err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := b.getSigningKeys(ctx, s, "named")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.current().kid != replaced.KeyID {
+		t.Errorf("got stale key %s, want %s", parsed.current().kid, replaced.KeyID)
+	}
+}
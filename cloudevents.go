@@ -0,0 +1,94 @@
+package webhook
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+)
+
+// Formats the document can be sent in.
+const (
+	formatDocument    = "document"
+	formatCloudEvents = "cloudevents"
+)
+
+var formats = []string{formatDocument, formatCloudEvents}
+
+// HTTP content modes of CloudEvents. Structured events carry their attributes in the body,
+// binary events in ce-* headers with only the data in the body.
+const (
+	cloudEventsStructured = "structured"
+	cloudEventsBinary     = "binary"
+)
+
+var cloudEventsModes = []string{cloudEventsStructured, cloudEventsBinary}
+
+const defaultCloudEventsType = "vault.webhook.request"
+
+// cloudEvent is a CloudEvents 1.0 event in its JSON format. The whole document is the
+// data, so the nonce, path, timestamp and entity the attributes are taken from are covered
+// by the signature in either mode.
+type cloudEvent struct {
+	SpecVersion     string   `json:"specversion"`
+	ID              string   `json:"id"`
+	Source          string   `json:"source"`
+	Type            string   `json:"type"`
+	Time            string   `json:"time"`
+	Subject         string   `json:"subject,omitempty"`
+	DataContentType string   `json:"datacontenttype"`
+	Data            Document `json:"data"`
+}
+
+// newCloudEvent wraps the document in an event whose source is the destination path,
+// such as /webhook/destination/hello.
+func newCloudEvent(doc Document, mountPoint, eventType string) cloudEvent {
+	subject := doc.EntityID
+	if doc.Entity != nil {
+		subject = doc.Entity.ID
+	}
+
+	return cloudEvent{
+		SpecVersion:     "1.0",
+		ID:              doc.Nonce,
+		Source:          "/" + strings.TrimSuffix(mountPoint, "/") + "/destination/" + doc.Path,
+		Type:            eventType,
+		Time:            time.Unix(doc.Timestamp, 0).UTC().Format(time.RFC3339),
+		Subject:         subject,
+		DataContentType: "application/json",
+		Data:            doc,
+	}
+}
+
+// serializeCloudEvent returns the HTTP body and headers of the event in the given mode.
+func serializeCloudEvent(event cloudEvent, mode string) ([]byte, http.Header, error) {
+	headers := http.Header{}
+
+	if mode == cloudEventsBinary {
+		body, err := json.Marshal(event.Data)
+		if err != nil {
+			return nil, nil, errwrap.Wrapf("could not marshal document: {{err}}", err)
+		}
+
+		headers.Set("Content-Type", event.DataContentType)
+		headers.Set("ce-specversion", event.SpecVersion)
+		headers.Set("ce-id", event.ID)
+		headers.Set("ce-source", event.Source)
+		headers.Set("ce-type", event.Type)
+		headers.Set("ce-time", event.Time)
+		if event.Subject != "" {
+			headers.Set("ce-subject", event.Subject)
+		}
+		return body, headers, nil
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return nil, nil, errwrap.Wrapf("could not marshal cloud event: {{err}}", err)
+	}
+	headers.Set("Content-Type", "application/cloudevents+json; charset=UTF-8")
+
+	return body, headers, nil
+}
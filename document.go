@@ -1,38 +1,299 @@
 package webhook
 
 import (
+	"bytes"
+	gocrypto "crypto"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
 	"github.com/SermoDigital/jose/crypto"
 	"github.com/SermoDigital/jose/jws"
 	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/logical"
 )
 
 // Document is serialized to JSON, signed using JWS and then POSTed to the target
-// server where the signature must be verified.
+// server where the signature must be verified. It is sent in the shape of its Version.
 type Document struct {
-	Nonce      string            `json:"nonce"`
-	Path       string            `json:"path"`
-	Timestamp  int64             `json:"timestamp"`
-	RequestID  string            `json:"request_id"`
-	EntityID   string            `json:"entity_id,omitempty"`
-	Parameters map[string]string `json:"params,omitempty"`
-	Metadata   map[string]string `json:"metadata,omitempty"`
+	Version    int                    `json:"version"`
+	Nonce      string                 `json:"nonce"`
+	Path       string                 `json:"path"`
+	Timestamp  int64                  `json:"timestamp"`
+	RequestID  string                 `json:"request_id"`
+	EntityID   string                 `json:"entity_id,omitempty"`
+	Entity     *EntityInfo            `json:"entity,omitempty"`
+	Token      *TokenInfo             `json:"token,omitempty"`
+	RemoteAddr string                 `json:"remote_address,omitempty"`
+	Headers    map[string][]string    `json:"headers,omitempty"`
+	Parameters map[string]interface{} `json:"params,omitempty"`
+	Metadata   map[string]string      `json:"metadata,omitempty"`
+}
+
+// EntityInfo describes the identity entity of the caller, as far as Vault shares it with
+// plugins.
+type EntityInfo struct {
+	ID      string        `json:"id"`
+	Name    string        `json:"name,omitempty"`
+	Aliases []EntityAlias `json:"aliases,omitempty"`
+}
+
+// EntityAlias is one of the logins an entity is known by.
+type EntityAlias struct {
+	MountType     string `json:"mount_type"`
+	MountAccessor string `json:"mount_accessor"`
+	Name          string `json:"name"`
+}
+
+// TokenInfo describes the token the caller authenticated with.
+type TokenInfo struct {
+	DisplayName string `json:"display_name"`
+	// AccessorHMAC identifies the token without revealing its accessor, which could be
+	// used to look up or revoke it.
+	AccessorHMAC string `json:"accessor_hmac,omitempty"`
+	// RemainingUses is 0 for tokens without a use limit.
+	RemainingUses int `json:"remaining_uses"`
+}
+
+// newEntityInfo converts the entity returned by Vault's system view.
+func newEntityInfo(entity *logical.Entity) *EntityInfo {
+	info := &EntityInfo{
+		ID:   entity.ID,
+		Name: entity.Name,
+	}
+	for _, alias := range entity.Aliases {
+		info.Aliases = append(info.Aliases, EntityAlias{
+			MountType:     alias.MountType,
+			MountAccessor: alias.MountAccessor,
+			Name:          alias.Name,
+		})
+	}
+	return info
+}
+
+// parameterValue converts a value sent by the caller to plain JSON types: strings, numbers
+// (kept as json.Number so large integers survive), booleans, nil, lists and objects.
+func parameterValue(v interface{}) (interface{}, error) {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(buf))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
 }
 
-func serializeDocument(doc Document, privKeyBytes []byte) ([]byte, error) {
+// claims returns the document as a set of JWT claims. The registered claims are added
+// alongside the document's own fields so existing targets keep working.
+func (doc Document) claims(issuer string, audience []string, expiry time.Duration) (jws.Claims, error) {
+	buf, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	// Decode numbers as json.Number so large integer parameters keep their precision.
+	decoder := json.NewDecoder(bytes.NewReader(buf))
+	decoder.UseNumber()
+
+	var fields map[string]interface{}
+	if err := decoder.Decode(&fields); err != nil {
+		return nil, err
+	}
+	claims := jws.Claims(fields)
+
+	issuedAt := time.Unix(doc.Timestamp, 0)
+
+	claims.SetIssuer(issuer)
+	if len(audience) > 0 {
+		claims.SetAudience(audience...)
+	}
+	if doc.EntityID != "" {
+		claims.SetSubject(doc.EntityID)
+	}
+	claims.SetIssuedAt(issuedAt)
+	claims.SetNotBefore(issuedAt)
+	claims.SetExpiration(issuedAt.Add(expiry))
+	claims.SetJWTID(doc.Nonce)
 
-	jws := jws.New(doc, crypto.SigningMethodRS512)
+	return claims, nil
+}
+
+// parsedJwsKey is a key version with its PEM encoded parts parsed, ready to sign with.
+type parsedJwsKey struct {
+	kid        string
+	method     crypto.SigningMethod
+	privKey    gocrypto.Signer
+	chain      []*x509.Certificate
+	retireTime time.Time
+}
 
-	privKey, err := crypto.ParseRSAPrivateKeyFromPEM(privKeyBytes)
+// parse prepares a key version for signing.
+func (k *jwsKey) parse() (*parsedJwsKey, error) {
+	method, ok := jwsSigningMethods[k.algorithm()]
+	if !ok {
+		return nil, fmt.Errorf("unsupported algorithm %q", k.algorithm())
+	}
 
+	privKey, err := parsePrivateKeyPEM([]byte(k.PrivateKey))
 	if err != nil {
 		return nil, errwrap.Wrapf("cryptography issue: {{err}}", err)
 	}
 
-	jwsBytes, err := jws.General(privKey)
+	chain, err := k.certificateChain()
+	if err != nil {
+		return nil, err
+	}
+
+	return &parsedJwsKey{
+		kid:        k.KeyID,
+		method:     method,
+		privKey:    privKey,
+		chain:      chain,
+		retireTime: k.RetireTime,
+	}, nil
+}
+
+// protectedHeader returns the JWS header parameters identifying the key: its "kid" and,
+// when it has a certificate, the "x5c" chain and "x5t#S256" thumbprint from RFC 7515.
+// The map is new on every call, so callers may add to it.
+func (k *parsedJwsKey) protectedHeader() map[string]interface{} {
+	header := map[string]interface{}{
+		"kid": k.kid,
+	}
+	if len(k.chain) > 0 {
+		header["x5c"] = x5c(k.chain)
+		header["x5t#S256"] = x5tS256(k.chain[0])
+	}
+	return header
+}
+
+// JWS serializations a destination can ask for.
+const (
+	serializationGeneral   = "general"
+	serializationFlattened = "flattened"
+	serializationCompact   = "compact"
+	serializationDetached  = "detached"
+
+	// serializationNone sends the plain JSON document without a JWS, for destinations that
+	// are authenticated with an HMAC signature instead.
+	serializationNone = "none"
+)
+
+var serializations = []string{serializationGeneral, serializationFlattened, serializationCompact, serializationDetached, serializationNone, serializationHTTPSignature}
+
+// detachedSignatureHeader carries the signature when the payload is sent detached.
+const detachedSignatureHeader = "X-JWS-Signature"
+
+// serializeDocument signs the document and returns the HTTP body to send along with any
+// headers the serialization needs. The general serialization carries a signature from
+// every key; the others only hold one and are signed by the first key.
+func serializeDocument(doc Document, serialization string, keys []*parsedJwsKey) ([]byte, http.Header, error) {
+
+	if serialization == serializationDetached {
+		return serializeDetached(doc, keys[0])
+	}
+	if serialization != serializationGeneral {
+		keys = keys[:1]
+	}
+
+	methods := make([]crypto.SigningMethod, len(keys))
+	privKeys := make([]interface{}, len(keys))
+	for i, key := range keys {
+		methods[i] = key.method
+		privKeys[i] = key.privKey
+	}
+
+	jws := jws.New(doc, methods...)
+	for i, key := range keys {
+		for name, value := range key.protectedHeader() {
+			jws.ProtectedAt(i).Set(name, value)
+		}
+	}
+
+	var jwsBytes []byte
+	var err error
+	switch serialization {
+	case serializationGeneral:
+		jwsBytes, err = jws.General(privKeys...)
+	case serializationFlattened:
+		jwsBytes, err = jws.Flat(privKeys[0])
+	case serializationCompact:
+		jwsBytes, err = jws.Compact(privKeys[0])
+	default:
+		return nil, nil, fmt.Errorf("unsupported serialization %q", serialization)
+	}
+	if err != nil {
+		return nil, nil, errwrap.Wrapf("jws issue: {{err}}", err)
+	}
+
+	return jwsBytes, http.Header{}, nil
+
+}
+
+// serializeDetached signs the document with an unencoded, detached payload per RFC 7797.
+// The plain JSON document is the body and the compact JWS, with an empty payload, goes in
+// a header.
+func serializeDetached(doc Document, key *parsedJwsKey) ([]byte, http.Header, error) {
+	payload, err := json.Marshal(doc)
+	if err != nil {
+		return nil, nil, errwrap.Wrapf("could not marshal document: {{err}}", err)
+	}
+
+	signature, err := signDetached(payload, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	headers := http.Header{}
+	headers.Set("Content-Type", "application/json")
+	headers.Set(detachedSignatureHeader, signature)
+
+	return payload, headers, nil
+}
+
+// signDetached returns a compact JWS over payload with the payload left out.
+func signDetached(payload []byte, key *parsedJwsKey) (string, error) {
+	header := key.protectedHeader()
+	header["alg"] = key.method.Alg()
+	header["b64"] = false
+	header["crit"] = []string{"b64"}
+
+	protected, err := json.Marshal(header)
+	if err != nil {
+		return "", errwrap.Wrapf("could not marshal jws header: {{err}}", err)
+	}
+	encodedProtected := base64.RawURLEncoding.EncodeToString(protected)
+
+	signingInput := append([]byte(encodedProtected+"."), payload...)
+	sig, err := key.method.Sign(signingInput, key.privKey)
 	if err != nil {
-		return nil, errwrap.Wrapf("jws issue: {{err}}", err)
+		return "", errwrap.Wrapf("jws issue: {{err}}", err)
+	}
+
+	return encodedProtected + ".." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// serializeJWT signs claims as a compact serialized JWT.
+func serializeJWT(claims jws.Claims, key *parsedJwsKey) ([]byte, error) {
+
+	jwt := jws.NewJWT(claims, key.method)
+	for name, value := range key.protectedHeader() {
+		jwt.(jws.JWS).Protected().Set(name, value)
 	}
 
-	return jwsBytes, nil
+	jwtBytes, err := jwt.Serialize(key.privKey)
+	if err != nil {
+		return nil, errwrap.Wrapf("jwt issue: {{err}}", err)
+	}
 
+	return jwtBytes, nil
 }
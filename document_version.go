@@ -0,0 +1,189 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Versions of the document. Each version's fields are fixed, so targets can rely on its
+// JSON Schema; adding or changing fields means adding a version.
+const (
+	// documentVersion1 is the original document: params are strings and there is no
+	// version field.
+	documentVersion1 = 1
+	// documentVersion2 adds the version field, keeps the JSON types of params and can
+	// carry the entity, token, remote address and headers of the caller.
+	documentVersion2 = 2
+
+	latestDocumentVersion = documentVersion2
+)
+
+var documentVersions = []int{documentVersion1, documentVersion2}
+
+// documentV1 is how a document is sent to destinations still on version 1.
+type documentV1 struct {
+	Nonce      string            `json:"nonce"`
+	Path       string            `json:"path"`
+	Timestamp  int64             `json:"timestamp"`
+	RequestID  string            `json:"request_id"`
+	EntityID   string            `json:"entity_id,omitempty"`
+	Parameters map[string]string `json:"params,omitempty"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+}
+
+// MarshalJSON encodes the document in the shape of its version.
+func (doc Document) MarshalJSON() ([]byte, error) {
+	if doc.Version == documentVersion1 {
+		v1, err := doc.v1()
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(v1)
+	}
+
+	// document has the fields of Document but not this method.
+	type document Document
+	return json.Marshal(document(doc))
+}
+
+// v1 converts the document to version 1. Parameters that aren't strings are sent as
+// their JSON text.
+func (doc Document) v1() (documentV1, error) {
+	v1 := documentV1{
+		Nonce:     doc.Nonce,
+		Path:      doc.Path,
+		Timestamp: doc.Timestamp,
+		RequestID: doc.RequestID,
+		EntityID:  doc.EntityID,
+		Metadata:  doc.Metadata,
+	}
+
+	if doc.Parameters != nil {
+		v1.Parameters = make(map[string]string, len(doc.Parameters))
+		for name, value := range doc.Parameters {
+			if s, ok := value.(string); ok {
+				v1.Parameters[name] = s
+				continue
+			}
+			buf, err := json.Marshal(value)
+			if err != nil {
+				return documentV1{}, fmt.Errorf("could not encode parameter %q: %s", name, err)
+			}
+			v1.Parameters[name] = string(buf)
+		}
+	}
+
+	return v1, nil
+}
+
+// documentSchema returns the JSON Schema of a document version.
+func documentSchema(version int) (map[string]interface{}, error) {
+	stringMap := map[string]interface{}{
+		"type":                 "object",
+		"additionalProperties": map[string]interface{}{"type": "string"},
+	}
+
+	properties := map[string]interface{}{
+		"nonce": map[string]interface{}{
+			"type":        "string",
+			"description": "Unique ID of the request, which can be looked up at the verify endpoint while the request is in flight.",
+		},
+		"path": map[string]interface{}{
+			"type":        "string",
+			"description": "Name of the destination.",
+		},
+		"timestamp": map[string]interface{}{
+			"type":        "integer",
+			"description": "When the document was built, in seconds since the Unix epoch.",
+		},
+		"request_id": map[string]interface{}{
+			"type":        "string",
+			"description": "ID of the Vault request.",
+		},
+		"entity_id": map[string]interface{}{
+			"type":        "string",
+			"description": "ID of the caller's identity entity.",
+		},
+		"metadata": stringMap,
+
+		// Documents sent as JWTs also carry the registered claims.
+		"iss": map[string]interface{}{"type": "string"},
+		"sub": map[string]interface{}{"type": "string"},
+		"aud": map[string]interface{}{
+			"type":  []string{"string", "array"},
+			"items": map[string]interface{}{"type": "string"},
+		},
+		"iat": map[string]interface{}{"type": "number"},
+		"nbf": map[string]interface{}{"type": "number"},
+		"exp": map[string]interface{}{"type": "number"},
+		"jti": map[string]interface{}{"type": "string"},
+	}
+	required := []string{"nonce", "path", "timestamp", "request_id"}
+
+	switch version {
+	case documentVersion1:
+		properties["params"] = stringMap
+
+	case documentVersion2:
+		properties["version"] = map[string]interface{}{"const": documentVersion2}
+		properties["params"] = map[string]interface{}{
+			"type":        "object",
+			"description": "Parameters of the caller, keeping their JSON types.",
+		}
+		properties["entity"] = map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"id":   map[string]interface{}{"type": "string"},
+				"name": map[string]interface{}{"type": "string"},
+				"aliases": map[string]interface{}{
+					"type": "array",
+					"items": map[string]interface{}{
+						"type": "object",
+						"properties": map[string]interface{}{
+							"mount_type":     map[string]interface{}{"type": "string"},
+							"mount_accessor": map[string]interface{}{"type": "string"},
+							"name":           map[string]interface{}{"type": "string"},
+						},
+						"required":             []string{"mount_type", "mount_accessor", "name"},
+						"additionalProperties": false,
+					},
+				},
+			},
+			"required":             []string{"id"},
+			"additionalProperties": false,
+		}
+		properties["token"] = map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"display_name":   map[string]interface{}{"type": "string"},
+				"accessor_hmac":  map[string]interface{}{"type": "string"},
+				"remaining_uses": map[string]interface{}{"type": "integer", "minimum": 0},
+			},
+			"required":             []string{"display_name", "remaining_uses"},
+			"additionalProperties": false,
+		}
+		properties["remote_address"] = map[string]interface{}{"type": "string"}
+		properties["headers"] = map[string]interface{}{
+			"type": "object",
+			"additionalProperties": map[string]interface{}{
+				"type":  "array",
+				"items": map[string]interface{}{"type": "string"},
+			},
+		}
+		required = append([]string{"version"}, required...)
+
+	default:
+		return nil, fmt.Errorf("unknown document version %d, must be one of %v", version, documentVersions)
+	}
+
+	return map[string]interface{}{
+		"$schema":    "https://json-schema.org/draft/2020-12/schema",
+		"title":      fmt.Sprintf("Vault webhook document, version %d", version),
+		"type":       "object",
+		"properties": properties,
+		"required":   required,
+
+		// A field outside the schema means the target is validating against the wrong version.
+		"additionalProperties": false,
+	}, nil
+}
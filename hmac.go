@@ -0,0 +1,110 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/logical"
+)
+
+// HMAC signature schemes a destination can ask for.
+const (
+	// hmacSchemeGitHub sends "X-Hub-Signature-256: sha256=<hex>" computed over the body.
+	hmacSchemeGitHub = "github"
+
+	// hmacSchemeStandardWebhooks follows https://www.standardwebhooks.com, sending the
+	// webhook-id, webhook-timestamp and webhook-signature headers.
+	hmacSchemeStandardWebhooks = "standard-webhooks"
+)
+
+var hmacSchemes = []string{hmacSchemeGitHub, hmacSchemeStandardWebhooks}
+
+// Standard Webhooks secrets are conventionally base64 with this prefix.
+const standardWebhooksSecretPrefix = "whsec_"
+
+// destinationSecretsPrefix is seal wrapped, keeping shared secrets apart from the rest of
+// a destination's configuration.
+const destinationSecretsPrefix = "config/secrets/destination/"
+
+// destinationSecrets holds the sensitive, write-only part of a destination's configuration.
+type destinationSecrets struct {
+	HMACSecret string `json:"hmac_secret"`
+}
+
+func getDestinationSecrets(ctx context.Context, s logical.Storage, name string) (*destinationSecrets, error) {
+	entry, err := s.Get(ctx, destinationSecretsPrefix+name)
+	if err != nil {
+		return nil, errwrap.Wrapf("could not get destination secrets: {{err}}", err)
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var secrets destinationSecrets
+	if err := json.Unmarshal(entry.Value, &secrets); err != nil {
+		return nil, errwrap.Wrapf("failed to unmarshal destination secrets: {{err}}", err)
+	}
+	return &secrets, nil
+}
+
+func putDestinationSecrets(ctx context.Context, s logical.Storage, name string, secrets *destinationSecrets) error {
+	buf, err := json.Marshal(secrets)
+	if err != nil {
+		return errwrap.Wrapf("failed to marshal destination secrets: {{err}}", err)
+	}
+
+	if err := s.Put(ctx, &logical.StorageEntry{Key: destinationSecretsPrefix + name, Value: buf}); err != nil {
+		return errwrap.Wrapf("could not store destination secrets: {{err}}", err)
+	}
+	return nil
+}
+
+// hmacKey returns the key bytes for a shared secret as the scheme interprets it.
+func hmacKey(scheme, secret string) ([]byte, error) {
+	if scheme != hmacSchemeStandardWebhooks {
+		return []byte(secret), nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(secret, standardWebhooksSecretPrefix))
+	if err != nil {
+		return nil, errwrap.Wrapf("standard-webhooks secrets must be base64 encoded: {{err}}", err)
+	}
+	return key, nil
+}
+
+// hmacHeaders signs body with the shared secret and returns the headers the scheme sends.
+func hmacHeaders(scheme, secret, msgID string, timestamp int64, body []byte) (http.Header, error) {
+	key, err := hmacKey(scheme, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := http.Header{}
+	mac := hmac.New(sha256.New, key)
+
+	switch scheme {
+	case hmacSchemeGitHub:
+		mac.Write(body)
+		headers.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	case hmacSchemeStandardWebhooks:
+		ts := strconv.FormatInt(timestamp, 10)
+		mac.Write([]byte(msgID + "." + ts + "."))
+		mac.Write(body)
+		headers.Set("webhook-id", msgID)
+		headers.Set("webhook-timestamp", ts)
+		headers.Set("webhook-signature", "v1,"+base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+	default:
+		return nil, fmt.Errorf("unsupported hmac scheme %q", scheme)
+	}
+
+	return headers, nil
+}
@@ -0,0 +1,126 @@
+package webhook
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+)
+
+// serializationHTTPSignature sends the plain JSON document and signs the request with an
+// HTTP Message Signature (RFC 9421) instead of a JWS.
+const serializationHTTPSignature = "http-signature"
+
+// httpSignatureLabel names the signature in the Signature and Signature-Input headers.
+const httpSignatureLabel = "vault"
+
+// httpSignatureAlgorithms maps the JWS algorithms that have an RFC 9421 equivalent to its
+// name. The signatures of both are encoded the same way.
+var httpSignatureAlgorithms = map[string]string{
+	"RS256": "rsa-v1_5-sha256",
+	"PS512": "rsa-pss-sha512",
+	"ES256": "ecdsa-p256-sha256",
+	"ES384": "ecdsa-p384-sha384",
+}
+
+// httpSignatureComponents are always signed; extra request headers can be added per
+// destination.
+var httpSignatureComponents = []string{"@method", "@target-uri", "content-digest", "content-type"}
+
+// signHTTPMessage adds a Content-Digest (RFC 9530) of the body to the headers and signs it,
+// together with the method, target URI and the named headers, in the Signature and
+// Signature-Input headers.
+func signHTTPMessage(method, targetURI string, body []byte, headers http.Header, extraHeaders []string, nonce string, created time.Time, key *parsedJwsKey) error {
+	alg, ok := httpSignatureAlgorithms[key.method.Alg()]
+	if !ok {
+		return fmt.Errorf("jws algorithm %s has no HTTP message signature equivalent, use one of %v", key.method.Alg(), httpSignatureAlgorithmNames())
+	}
+
+	digest := sha256.Sum256(body)
+	headers.Set("Content-Digest", "sha-256=:"+base64.StdEncoding.EncodeToString(digest[:])+":")
+
+	components := append(append([]string{}, httpSignatureComponents...), extraHeaders...)
+
+	var base strings.Builder
+	quoted := make([]string, len(components))
+	for i, component := range components {
+		var value string
+		switch component {
+		case "@method":
+			value = method
+		case "@target-uri":
+			value = targetURI
+		default:
+			values := headers[http.CanonicalHeaderKey(component)]
+			if len(values) == 0 {
+				return fmt.Errorf("header %s to sign is not set on the request", component)
+			}
+			trimmed := make([]string, len(values))
+			for i, v := range values {
+				trimmed[i] = strings.TrimSpace(v)
+			}
+			value = strings.Join(trimmed, ", ")
+		}
+
+		name, err := sfString(component)
+		if err != nil {
+			return err
+		}
+		quoted[i] = name
+		fmt.Fprintf(&base, "%s: %s\n", name, value)
+	}
+
+	params := fmt.Sprintf("(%s);created=%d", strings.Join(quoted, " "), created.Unix())
+	for _, param := range [][2]string{{"keyid", key.kid}, {"alg", alg}, {"nonce", nonce}} {
+		value, err := sfString(param[1])
+		if err != nil {
+			return err
+		}
+		params += ";" + param[0] + "=" + value
+	}
+	fmt.Fprintf(&base, "\"@signature-params\": %s", params)
+
+	sig, err := key.method.Sign([]byte(base.String()), key.privKey)
+	if err != nil {
+		return errwrap.Wrapf("could not sign request: {{err}}", err)
+	}
+
+	headers.Set("Signature-Input", httpSignatureLabel+"="+params)
+	headers.Set("Signature", httpSignatureLabel+"=:"+base64.StdEncoding.EncodeToString(sig)+":")
+
+	return nil
+}
+
+// sfString encodes s as an RFC 8941 structured field string, which only holds printable
+// ASCII and escapes nothing but the quote and the backslash.
+func sfString(s string) (string, error) {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 0x20 || c > 0x7e {
+			return "", fmt.Errorf("%q can't be sent in a structured field, only printable ASCII can", s)
+		}
+		if c == '"' || c == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(c)
+	}
+	b.WriteByte('"')
+	return b.String(), nil
+}
+
+// httpSignatureAlgorithmNames lists the JWS algorithms HTTP message signatures support.
+func httpSignatureAlgorithmNames() []string {
+	var algs []string
+	for alg := range httpSignatureAlgorithms {
+		algs = append(algs, alg)
+	}
+	sort.Strings(algs)
+	return algs
+}
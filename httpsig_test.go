@@ -0,0 +1,159 @@
+package webhook
+
+import (
+	gocrypto "crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"math/big"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSFString(t *testing.T) {
+	for in, want := range map[string]string{
+		"":                `""`,
+		"kid-1_x.y":       `"kid-1_x.y"`,
+		`say "hi"`:        `"say \"hi\""`,
+		`back\slash`:      `"back\\slash"`,
+		"~ !#$%&'()*+,/:": `"~ !#$%&'()*+,/:"`,
+	} {
+		got, err := sfString(in)
+		if err != nil {
+			t.Errorf("%q: %s", in, err)
+		} else if got != want {
+			t.Errorf("%q: got %s, want %s", in, got, want)
+		}
+	}
+
+	for _, in := range []string{"new\nline", "tab\t", "café", "\x7f"} {
+		if got, err := sfString(in); err == nil {
+			t.Errorf("%q: expected an error, got %s", in, got)
+		}
+	}
+}
+
+// TestSignHTTPMessageContentDigest checks the example of RFC 9530 section 2.
+func TestSignHTTPMessageContentDigest(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	headers := http.Header{"Content-Type": {"application/json"}}
+	parsed := &parsedJwsKey{kid: "k", method: jwsSigningMethods["ES256"], privKey: key}
+	if err := signHTTPMessage("POST", "https://example.com/", []byte(`{"hello": "world"}`), headers, nil, "n", time.Now(), parsed); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := headers.Get("Content-Digest"), "sha-256=:X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=:"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+// TestSignHTTPMessage rebuilds the signature base of RFC 9421 section 2.5 by hand and
+// verifies the signature with the standard library, for every supported algorithm.
+func TestSignHTTPMessage(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p256Key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifiers := map[string]struct {
+		key    gocrypto.Signer
+		verify func(base string, sig []byte) bool
+	}{
+		"rsa-v1_5-sha256": {rsaKey, func(base string, sig []byte) bool {
+			sum := sha256.Sum256([]byte(base))
+			return rsa.VerifyPKCS1v15(&rsaKey.PublicKey, gocrypto.SHA256, sum[:], sig) == nil
+		}},
+		"rsa-pss-sha512": {rsaKey, func(base string, sig []byte) bool {
+			sum := sha512.Sum512([]byte(base))
+			return rsa.VerifyPSS(&rsaKey.PublicKey, gocrypto.SHA512, sum[:], sig, &rsa.PSSOptions{SaltLength: 64}) == nil
+		}},
+		"ecdsa-p256-sha256": {p256Key, func(base string, sig []byte) bool {
+			sum := sha256.Sum256([]byte(base))
+			return len(sig) == 64 && ecdsa.Verify(&p256Key.PublicKey, sum[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:]))
+		}},
+		"ecdsa-p384-sha384": {p384Key, func(base string, sig []byte) bool {
+			sum := sha512.Sum384([]byte(base))
+			return len(sig) == 96 && ecdsa.Verify(&p384Key.PublicKey, sum[:], new(big.Int).SetBytes(sig[:48]), new(big.Int).SetBytes(sig[48:]))
+		}},
+	}
+
+	body := []byte(`{"hello": "world"}`)
+	created := time.Unix(1618884473, 0)
+
+	for jwsAlg, alg := range httpSignatureAlgorithms {
+		verifier := verifiers[alg]
+		key := &parsedJwsKey{kid: "test-key", method: jwsSigningMethods[jwsAlg], privKey: verifier.key}
+
+		headers := http.Header{
+			"Content-Type": {"application/json"},
+			"X-Extra":      {" one ", "two"},
+		}
+		if err := signHTTPMessage("POST", "https://example.com/hook?a=1", body, headers, []string{"x-extra"}, "nonce-1", created, key); err != nil {
+			t.Fatalf("%s: %s", alg, err)
+		}
+
+		params := `("@method" "@target-uri" "content-digest" "content-type" "x-extra");created=1618884473;keyid="test-key";alg="` + alg + `";nonce="nonce-1"`
+		if got, want := headers.Get("Signature-Input"), "vault="+params; got != want {
+			t.Errorf("%s: got Signature-Input %s, want %s", alg, got, want)
+			continue
+		}
+
+		base := strings.Join([]string{
+			`"@method": POST`,
+			`"@target-uri": https://example.com/hook?a=1`,
+			`"content-digest": ` + headers.Get("Content-Digest"),
+			`"content-type": application/json`,
+			`"x-extra": one, two`,
+			`"@signature-params": ` + params,
+		}, "\n")
+
+		signature := headers.Get("Signature")
+		if !strings.HasPrefix(signature, "vault=:") || !strings.HasSuffix(signature, ":") {
+			t.Fatalf("%s: malformed Signature %s", alg, signature)
+		}
+		sig, err := base64.StdEncoding.DecodeString(strings.TrimSuffix(strings.TrimPrefix(signature, "vault=:"), ":"))
+		if err != nil {
+			t.Fatalf("%s: %s", alg, err)
+		}
+
+		if !verifier.verify(base, sig) {
+			t.Errorf("%s: signature does not verify", alg)
+		}
+	}
+}
+
+func TestSignHTTPMessageRequiresSignedHeaders(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed := &parsedJwsKey{kid: "k", method: jwsSigningMethods["ES256"], privKey: key}
+
+	headers := http.Header{"Content-Type": {"application/json"}}
+	if err := signHTTPMessage("POST", "https://example.com/", nil, headers, []string{"x-missing"}, "n", time.Now(), parsed); err == nil {
+		t.Error("signed a header that is not set")
+	}
+
+	parsed.method = jwsSigningMethods["RS512"]
+	if err := signHTTPMessage("POST", "https://example.com/", nil, headers, nil, "n", time.Now(), parsed); err == nil {
+		t.Error("signed with an algorithm that has no HTTP message signature equivalent")
+	}
+}
@@ -0,0 +1,188 @@
+package webhook
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/errwrap"
+)
+
+// JWE key management algorithms a destination can encrypt with.
+const (
+	jweAlgorithmRSAOAEP256 = "RSA-OAEP-256"
+	jweAlgorithmECDHES     = "ECDH-ES"
+)
+
+var jweAlgorithms = []string{jweAlgorithmRSAOAEP256, jweAlgorithmECDHES}
+
+// JWE content encryption algorithms, mapped to their key size in bytes.
+var jweEncryptions = map[string]int{
+	"A128GCM": 16,
+	"A192GCM": 24,
+	"A256GCM": 32,
+}
+
+// validateEncryptionKey checks that the target's public key can be used with the key
+// management algorithm.
+func validateEncryptionKey(alg string, pub interface{}) error {
+	switch pub.(type) {
+	case *rsa.PublicKey:
+		if alg != jweAlgorithmRSAOAEP256 {
+			return fmt.Errorf("encryption algorithm %s can't be used with an RSA key", alg)
+		}
+	case *ecdsa.PublicKey:
+		if alg != jweAlgorithmECDHES {
+			return fmt.Errorf("encryption algorithm %s can't be used with an EC key", alg)
+		}
+	default:
+		return fmt.Errorf("unsupported encryption key type %T", pub)
+	}
+	return nil
+}
+
+// encryptJWE encrypts payload to the target's public key and returns the compact JWE
+// serialization, per RFC 7516. cty describes the payload.
+func encryptJWE(payload []byte, alg, enc, cty string, pub interface{}) ([]byte, error) {
+	keySize, ok := jweEncryptions[enc]
+	if !ok {
+		return nil, fmt.Errorf("unsupported content encryption %q", enc)
+	}
+
+	jwk, err := newJSONWebKey(pub)
+	if err != nil {
+		return nil, err
+	}
+
+	header := map[string]interface{}{
+		"alg": alg,
+		"enc": enc,
+		"kid": jwk.thumbprint(),
+	}
+	if cty != "" {
+		header["cty"] = cty
+	}
+
+	var cek, encryptedKey []byte
+
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		cek = make([]byte, keySize)
+		if _, err := rand.Read(cek); err != nil {
+			return nil, err
+		}
+		encryptedKey, err = rsa.EncryptOAEP(sha256.New(), rand.Reader, key, cek, nil)
+		if err != nil {
+			return nil, errwrap.Wrapf("could not encrypt content key: {{err}}", err)
+		}
+	case *ecdsa.PublicKey:
+		// With direct key agreement the content key is derived and nothing is sent for it.
+		var epk *jsonWebKey
+		cek, epk, err = deriveECDHESKey(key, enc, keySize)
+		if err != nil {
+			return nil, err
+		}
+		header["epk"] = epk
+	default:
+		return nil, fmt.Errorf("unsupported encryption key type %T", pub)
+	}
+
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+	protected := base64.RawURLEncoding.EncodeToString(headerJSON)
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	iv := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+
+	sealed := gcm.Seal(nil, iv, payload, []byte(protected))
+	ciphertext, tag := sealed[:len(sealed)-gcm.Overhead()], sealed[len(sealed)-gcm.Overhead():]
+
+	return []byte(strings.Join([]string{
+		protected,
+		base64.RawURLEncoding.EncodeToString(encryptedKey),
+		base64.RawURLEncoding.EncodeToString(iv),
+		base64.RawURLEncoding.EncodeToString(ciphertext),
+		base64.RawURLEncoding.EncodeToString(tag),
+	}, ".")), nil
+}
+
+// deriveECDHESKey agrees a content key with the target using an ephemeral key on the
+// target's curve, per RFC 7518 section 4.6. It returns the key and the ephemeral public key.
+func deriveECDHESKey(pub *ecdsa.PublicKey, enc string, keySize int) ([]byte, *jsonWebKey, error) {
+	remote, err := pub.ECDH()
+	if err != nil {
+		return nil, nil, errwrap.Wrapf("invalid encryption key: {{err}}", err)
+	}
+
+	ephemeral, err := ecdsa.GenerateKey(pub.Curve, rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	local, err := ephemeral.ECDH()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	z, err := local.ECDH(remote)
+	if err != nil {
+		return nil, nil, errwrap.Wrapf("key agreement failed: {{err}}", err)
+	}
+
+	epk, err := newJSONWebKey(&ephemeral.PublicKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return concatKDF(z, enc, keySize), epk, nil
+}
+
+// concatKDF is the NIST SP 800-56A Concatenation KDF with SHA-256, using the OtherInfo
+// layout of RFC 7518 section 4.6.2 with empty PartyUInfo and PartyVInfo.
+func concatKDF(z []byte, algID string, keySize int) []byte {
+	lengthPrefixed := func(b []byte) []byte {
+		out := make([]byte, 4+len(b))
+		binary.BigEndian.PutUint32(out, uint32(len(b)))
+		copy(out[4:], b)
+		return out
+	}
+
+	var otherInfo []byte
+	otherInfo = append(otherInfo, lengthPrefixed([]byte(algID))...)
+	otherInfo = append(otherInfo, lengthPrefixed(nil)...)
+	otherInfo = append(otherInfo, lengthPrefixed(nil)...)
+	suppPubInfo := make([]byte, 4)
+	binary.BigEndian.PutUint32(suppPubInfo, uint32(keySize*8))
+	otherInfo = append(otherInfo, suppPubInfo...)
+
+	var key []byte
+	for counter := uint32(1); len(key) < keySize; counter++ {
+		h := sha256.New()
+		binary.Write(h, binary.BigEndian, counter)
+		h.Write(z)
+		h.Write(otherInfo)
+		key = h.Sum(key)
+	}
+
+	return key[:keySize]
+}
@@ -0,0 +1,157 @@
+package webhook
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// testJWE is a compact JWE taken apart, for decrypting with the standard library alone.
+type testJWE struct {
+	protected    string
+	header       map[string]interface{}
+	encryptedKey []byte
+	iv           []byte
+	ciphertext   []byte
+	tag          []byte
+}
+
+func parseTestJWE(t *testing.T, compact []byte) *testJWE {
+	parts := strings.Split(string(compact), ".")
+	if len(parts) != 5 {
+		t.Fatalf("expected 5 parts in a compact JWE, got %d", len(parts))
+	}
+
+	var decoded [5][]byte
+	for i, part := range parts {
+		b, err := base64.RawURLEncoding.DecodeString(part)
+		if err != nil {
+			t.Fatalf("part %d: %s", i, err)
+		}
+		decoded[i] = b
+	}
+
+	jwe := &testJWE{
+		protected:    parts[0],
+		encryptedKey: decoded[1],
+		iv:           decoded[2],
+		ciphertext:   decoded[3],
+		tag:          decoded[4],
+	}
+	if err := json.Unmarshal(decoded[0], &jwe.header); err != nil {
+		t.Fatal(err)
+	}
+	return jwe
+}
+
+// open decrypts the content with AES-GCM, the protected header as additional data.
+func (jwe *testJWE) open(t *testing.T, cek []byte) []byte {
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := gcm.Open(nil, jwe.iv, append(jwe.ciphertext, jwe.tag...), []byte(jwe.protected))
+	if err != nil {
+		t.Fatalf("could not decrypt content: %s", err)
+	}
+	return plain
+}
+
+func TestEncryptJWERSAOAEP256(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := []byte("header.payload.signature")
+
+	out, err := encryptJWE(payload, jweAlgorithmRSAOAEP256, "A256GCM", "JWT", &key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwe := parseTestJWE(t, out)
+
+	if jwe.header["alg"] != "RSA-OAEP-256" || jwe.header["enc"] != "A256GCM" || jwe.header["cty"] != "JWT" {
+		t.Errorf("unexpected header %v", jwe.header)
+	}
+
+	cek, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, key, jwe.encryptedKey, nil)
+	if err != nil {
+		t.Fatalf("could not decrypt content key: %s", err)
+	}
+	if len(cek) != 32 {
+		t.Fatalf("expected a 256 bit content key, got %d bits", len(cek)*8)
+	}
+
+	if got := jwe.open(t, cek); string(got) != string(payload) {
+		t.Errorf("got %q, want %q", got, payload)
+	}
+}
+
+func TestEncryptJWEECDHES(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := []byte(`{"payload":"...","signatures":[]}`)
+
+	out, err := encryptJWE(payload, jweAlgorithmECDHES, "A128GCM", "JOSE+JSON", &key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwe := parseTestJWE(t, out)
+
+	if jwe.header["alg"] != "ECDH-ES" || jwe.header["enc"] != "A128GCM" {
+		t.Errorf("unexpected header %v", jwe.header)
+	}
+	if len(jwe.encryptedKey) != 0 {
+		t.Errorf("direct key agreement must not send an encrypted key")
+	}
+
+	epk, ok := jwe.header["epk"].(map[string]interface{})
+	if !ok || epk["kty"] != "EC" || epk["crv"] != "P-256" {
+		t.Fatalf("unexpected epk %v", jwe.header["epk"])
+	}
+	x, _ := base64.RawURLEncoding.DecodeString(epk["x"].(string))
+	y, _ := base64.RawURLEncoding.DecodeString(epk["y"].(string))
+	ephemeral, err := ecdh.P256().NewPublicKey(append(append([]byte{4}, x...), y...))
+	if err != nil {
+		t.Fatalf("invalid epk: %s", err)
+	}
+
+	priv, err := key.ECDH()
+	if err != nil {
+		t.Fatal(err)
+	}
+	z, err := priv.ECDH(ephemeral)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// One round of the Concat KDF from RFC 7518 section 4.6.2: the counter, Z and an
+	// OtherInfo of AlgorithmID "A128GCM", empty PartyUInfo and PartyVInfo, and 128 bits.
+	h := sha256.New()
+	h.Write([]byte{0, 0, 0, 1})
+	h.Write(z)
+	h.Write([]byte{0, 0, 0, 7})
+	h.Write([]byte("A128GCM"))
+	h.Write([]byte{0, 0, 0, 0, 0, 0, 0, 0})
+	h.Write([]byte{0, 0, 0, 128})
+	cek := h.Sum(nil)[:16]
+
+	if got := jwe.open(t, cek); string(got) != string(payload) {
+		t.Errorf("got %q, want %q", got, payload)
+	}
+}
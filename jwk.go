@@ -0,0 +1,79 @@
+package webhook
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+)
+
+// jsonWebKey is the public half of a signing key, as described by RFC 7517.
+type jsonWebKey struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid,omitempty"`
+	Use       string `json:"use,omitempty"`
+	Algorithm string `json:"alg,omitempty"`
+
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// EC
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+	Y     string `json:"y,omitempty"`
+
+	// X.509, when the key was configured with a certificate
+	X5C     []string `json:"x5c,omitempty"`
+	X5TS256 string   `json:"x5t#S256,omitempty"`
+}
+
+// jsonWebKeySet is an RFC 7517 JWK Set.
+type jsonWebKeySet struct {
+	Keys []*jsonWebKey `json:"keys"`
+}
+
+func newJSONWebKey(pub interface{}) (*jsonWebKey, error) {
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		return &jsonWebKey{
+			KeyType: "RSA",
+			N:       base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:       base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}, nil
+	case *ecdsa.PublicKey:
+		// Coordinates are padded to the full width of the curve, per RFC 7518 section 6.2.1.
+		size := (key.Curve.Params().BitSize + 7) / 8
+		x := make([]byte, size)
+		y := make([]byte, size)
+		xBytes, yBytes := key.X.Bytes(), key.Y.Bytes()
+		copy(x[size-len(xBytes):], xBytes)
+		copy(y[size-len(yBytes):], yBytes)
+
+		return &jsonWebKey{
+			KeyType: "EC",
+			Curve:   key.Curve.Params().Name,
+			X:       base64.RawURLEncoding.EncodeToString(x),
+			Y:       base64.RawURLEncoding.EncodeToString(y),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", pub)
+	}
+}
+
+// thumbprint computes the RFC 7638 thumbprint of the key, which is used as its "kid".
+func (k *jsonWebKey) thumbprint() string {
+	// Only the required members, in lexicographic order and without whitespace.
+	var members string
+	switch k.KeyType {
+	case "RSA":
+		members = fmt.Sprintf(`{"e":"%s","kty":"RSA","n":"%s"}`, k.E, k.N)
+	case "EC":
+		members = fmt.Sprintf(`{"crv":"%s","kty":"EC","x":"%s","y":"%s"}`, k.Curve, k.X, k.Y)
+	}
+
+	sum := sha256.Sum256([]byte(members))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,443 @@
+package webhook
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/logical"
+)
+
+const (
+	// defaultJwsKeyName is the key used by destinations that don't name one. It is stored
+	// where the single key ring lived before named keys existed.
+	defaultJwsKeyName = "default"
+	jwsKeyRingPath    = "config/keys/jws/keyring"
+
+	namedJwsKeyRingPrefix = "config/keys/jws/named/"
+
+	// Where a single, unversioned key pair was stored before key rotation existed.
+	legacyJwsCertificatePath = "config/keys/jws/certificate"
+	legacyJwsPrivateKeyPath  = "config/keys/jws/private_key"
+
+	defaultJwsGracePeriod = 24 * time.Hour
+)
+
+// jwsKey is one version of the JWS signing key.
+type jwsKey struct {
+	Version      int       `json:"version"`
+	KeyID        string    `json:"kid"`
+	Algorithm    string    `json:"algorithm"`
+	Certificate  string    `json:"certificate"`
+	PrivateKey   string    `json:"private_key"`
+	CreationTime time.Time `json:"creation_time"`
+
+	// RetireTime is when a superseded key stops being published. It is zero
+	// while the key is still the one used for signing.
+	RetireTime time.Time `json:"retire_time,omitempty"`
+}
+
+// publicKey returns the public half of the key.
+func (k *jwsKey) publicKey() (interface{}, error) {
+	privKey, err := parsePrivateKeyPEM([]byte(k.PrivateKey))
+	if err != nil {
+		return nil, errwrap.Wrapf("could not parse private_key: {{err}}", err)
+	}
+	return privKey.Public(), nil
+}
+
+// algorithm returns the JWS algorithm the key signs with.
+func (k *jwsKey) algorithm() string {
+	if k.Algorithm == "" {
+		return defaultRSAAlgorithm
+	}
+	return k.Algorithm
+}
+
+// publicInfo describes the public half of the key and its lifecycle, so target operators
+// can pin and audit the keys they trust. The private key is never included.
+func (k *jwsKey) publicInfo() (map[string]interface{}, error) {
+	pub, err := k.publicKey()
+	if err != nil {
+		return nil, err
+	}
+
+	keyType, keyBits, curve, err := describePublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+
+	fingerprint, err := publicKeyFingerprint(pub)
+	if err != nil {
+		return nil, err
+	}
+
+	chain, err := k.certificateChain()
+	if err != nil {
+		return nil, err
+	}
+
+	// A key stops being trustworthy when it is retired or its certificate expires,
+	// whichever comes first.
+	expiration := k.RetireTime
+	if len(chain) > 0 && (expiration.IsZero() || chain[0].NotAfter.Before(expiration)) {
+		expiration = chain[0].NotAfter
+	}
+
+	info := map[string]interface{}{
+		"version":            k.Version,
+		"kid":                k.KeyID,
+		"algorithm":          k.algorithm(),
+		"key_type":           keyType,
+		"key_bits":           keyBits,
+		"fingerprint_sha256": fingerprint,
+		"certificate":        k.Certificate,
+		"creation_time":      formatTime(k.CreationTime),
+		"retire_time":        formatTime(k.RetireTime),
+		"expiration_time":    formatTime(expiration),
+	}
+	if curve != "" {
+		info["curve"] = curve
+	}
+
+	return info, nil
+}
+
+// formatTime formats t as RFC 3339, or returns nil for the zero time.
+func formatTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t.Format(time.RFC3339)
+}
+
+// certificateChain returns the X.509 certificate of the key followed by its chain, or nil
+// if the key was configured with a bare public key.
+func (k *jwsKey) certificateChain() ([]*x509.Certificate, error) {
+	if k.Certificate == "" {
+		return nil, nil
+	}
+	_, chain, err := parseCertificatePEM([]byte(k.Certificate))
+	if err != nil {
+		return nil, errwrap.Wrapf("could not parse certificate: {{err}}", err)
+	}
+	return chain, nil
+}
+
+// hasCertificate reports whether the key was configured with an X.509 certificate rather
+// than a bare public key.
+func (k *jwsKey) hasCertificate() (bool, error) {
+	chain, err := k.certificateChain()
+	if err != nil {
+		return false, err
+	}
+	return len(chain) > 0, nil
+}
+
+// x5c encodes a certificate chain as the "x5c" JWS header and JWK member expect.
+func x5c(chain []*x509.Certificate) []string {
+	encoded := make([]string, len(chain))
+	for i, cert := range chain {
+		encoded[i] = base64.StdEncoding.EncodeToString(cert.Raw)
+	}
+	return encoded
+}
+
+// x5tS256 is the base64url encoded SHA-256 thumbprint of a certificate.
+func x5tS256(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// jwsKeyRing holds every version of the JWS signing key the backend still knows about.
+type jwsKeyRing struct {
+	LatestVersion int             `json:"latest_version"`
+	GracePeriod   time.Duration   `json:"grace_period"`
+	Keys          map[int]*jwsKey `json:"keys"`
+
+	// AutoRotatePeriod is how old the current key may get before the backend replaces it
+	// with a generated one. Zero disables automatic rotation.
+	AutoRotatePeriod time.Duration `json:"auto_rotate_period,omitempty"`
+
+	// DualSign has documents in the general serialization also signed by rotated-out keys
+	// that are still inside their grace period.
+	DualSign bool `json:"dual_sign,omitempty"`
+}
+
+// current returns the key used to sign new documents.
+func (r *jwsKeyRing) current() *jwsKey {
+	return r.Keys[r.LatestVersion]
+}
+
+// versions returns all known key versions in ascending order.
+func (r *jwsKeyRing) versions() []int {
+	versions := make([]int, 0, len(r.Keys))
+	for v := range r.Keys {
+		versions = append(versions, v)
+	}
+	sort.Ints(versions)
+	return versions
+}
+
+// publishAhead is how long before an automatic rotation the next key is published, so
+// targets that cache the key set already have it when documents signed by it arrive. It
+// is the grace period, but at most half the auto rotation period.
+func (r *jwsKeyRing) publishAhead() time.Duration {
+	if r.GracePeriod > r.AutoRotatePeriod/2 {
+		return r.AutoRotatePeriod / 2
+	}
+	return r.GracePeriod
+}
+
+// pending returns the key generated ahead of the next automatic rotation, which is
+// published but doesn't sign yet, or nil if there is none.
+func (r *jwsKeyRing) pending() *jwsKey {
+	return r.Keys[r.LatestVersion+1]
+}
+
+// discardPending drops the key generated ahead of an automatic rotation, if any.
+func (r *jwsKeyRing) discardPending() {
+	delete(r.Keys, r.LatestVersion+1)
+}
+
+// dueForPublishing reports whether the key that will replace the current one should be
+// generated and published.
+func (r *jwsKeyRing) dueForPublishing(now time.Time) bool {
+	if r.AutoRotatePeriod <= 0 || r.pending() != nil {
+		return false
+	}
+	return !now.Before(r.current().CreationTime.Add(r.AutoRotatePeriod - r.publishAhead()))
+}
+
+// dueForRotation reports whether the pending key should replace the current one: the
+// current key has outlived the auto rotation period and the pending key has been
+// published for long enough.
+func (r *jwsKeyRing) dueForRotation(now time.Time) bool {
+	pending := r.pending()
+	if r.AutoRotatePeriod <= 0 || pending == nil {
+		return false
+	}
+	return !now.Before(r.current().CreationTime.Add(r.AutoRotatePeriod)) &&
+		!now.Before(pending.CreationTime.Add(r.publishAhead()))
+}
+
+// published returns the keys whose public halves targets should still trust, oldest first.
+func (r *jwsKeyRing) published(now time.Time) []*jwsKey {
+	var keys []*jwsKey
+	for _, v := range r.versions() {
+		key := r.Keys[v]
+		if key.RetireTime.IsZero() || now.Before(key.RetireTime) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// addKey makes the given key pair the current signing key. If algorithm is empty, one
+// suitable for the key type is chosen. The previously current key stays published until
+// the ring's grace period has passed.
+func (r *jwsKeyRing) addKey(certificate, privateKey, algorithm string, now time.Time) (*jwsKey, error) {
+	key, err := r.newKey(certificate, privateKey, algorithm, now)
+	if err != nil {
+		return nil, err
+	}
+
+	// A manual rotation supersedes a key published ahead of an automatic one.
+	r.discardPending()
+	r.Keys[key.Version] = key
+	r.activatePending(now)
+
+	return key, nil
+}
+
+// stageKey publishes the given key pair as the pending key, ahead of the automatic
+// rotation that makes it the current signing key.
+func (r *jwsKeyRing) stageKey(certificate, privateKey, algorithm string, now time.Time) (*jwsKey, error) {
+	key, err := r.newKey(certificate, privateKey, algorithm, now)
+	if err != nil {
+		return nil, err
+	}
+
+	r.Keys[key.Version] = key
+
+	return key, nil
+}
+
+// activatePending makes the pending key the current signing key. The previously current
+// key stays published until the ring's grace period has passed.
+func (r *jwsKeyRing) activatePending(now time.Time) {
+	if prev := r.current(); prev != nil {
+		prev.RetireTime = now.Add(r.GracePeriod)
+	}
+	r.LatestVersion++
+}
+
+// newKey validates the given key pair and returns it as the next version of the ring,
+// without adding it.
+func (r *jwsKeyRing) newKey(certificate, privateKey, algorithm string, now time.Time) (*jwsKey, error) {
+	privKey, err := parsePrivateKeyPEM([]byte(privateKey))
+	if err != nil {
+		return nil, errwrap.Wrapf("could not parse private_key: {{err}}", err)
+	}
+
+	if algorithm == "" {
+		algorithm, err = defaultAlgorithm(privKey.Public())
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := validateAlgorithm(algorithm, privKey.Public()); err != nil {
+		return nil, err
+	}
+
+	jwk, err := newJSONWebKey(privKey.Public())
+	if err != nil {
+		return nil, err
+	}
+	kid := jwk.thumbprint()
+
+	for _, key := range r.Keys {
+		if key.KeyID == kid {
+			return nil, fmt.Errorf("key is already version %d of the key ring", key.Version)
+		}
+	}
+
+	if r.Keys == nil {
+		r.Keys = make(map[int]*jwsKey)
+	}
+
+	return &jwsKey{
+		Version:      r.LatestVersion + 1,
+		KeyID:        kid,
+		Algorithm:    algorithm,
+		Certificate:  certificate,
+		PrivateKey:   privateKey,
+		CreationTime: now,
+	}, nil
+}
+
+// reservedJwsKeyNames can't be used as key names because they are path segments under config/keys/jws.
+var reservedJwsKeyNames = []string{"rotate", "generate", "versions"}
+
+func jwsKeyRingStoragePath(name string) string {
+	if name == defaultJwsKeyName {
+		return jwsKeyRingPath
+	}
+	return namedJwsKeyRingPrefix + name
+}
+
+// listJwsKeyRings returns the names of all configured signing keys.
+func listJwsKeyRings(ctx context.Context, s logical.Storage) ([]string, error) {
+	names, err := s.List(ctx, namedJwsKeyRingPrefix)
+	if err != nil {
+		return nil, errwrap.Wrapf("could not list jws keys: {{err}}", err)
+	}
+
+	ring, err := getJwsKeyRing(ctx, s, defaultJwsKeyName)
+	if err != nil {
+		return nil, err
+	}
+	if ring != nil {
+		names = append([]string{defaultJwsKeyName}, names...)
+	}
+
+	return names, nil
+}
+
+// getJwsKeyRing loads the named JWS key ring from storage. For the default key, a key pair
+// written before key rotation existed is presented as version 1 until the ring is next
+// saved. Returns nil if the key has not been configured.
+func getJwsKeyRing(ctx context.Context, s logical.Storage, name string) (*jwsKeyRing, error) {
+	entry, err := s.Get(ctx, jwsKeyRingStoragePath(name))
+	if err != nil {
+		return nil, errwrap.Wrapf("could not get jws key ring: {{err}}", err)
+	}
+
+	if entry != nil {
+		var ring jwsKeyRing
+		if err := json.Unmarshal(entry.Value, &ring); err != nil {
+			return nil, errwrap.Wrapf("failed to unmarshal jws key ring: {{err}}", err)
+		}
+		return &ring, nil
+	}
+
+	if name != defaultJwsKeyName {
+		return nil, nil
+	}
+
+	privEntry, err := s.Get(ctx, legacyJwsPrivateKeyPath)
+	if err != nil {
+		return nil, errwrap.Wrapf("could not get jws private_key: {{err}}", err)
+	}
+	if privEntry == nil {
+		return nil, nil
+	}
+
+	certEntry, err := s.Get(ctx, legacyJwsCertificatePath)
+	if err != nil {
+		return nil, errwrap.Wrapf("could not get jws certificate: {{err}}", err)
+	}
+
+	var certificate string
+	if certEntry != nil {
+		certificate = string(certEntry.Value)
+	}
+
+	// The legacy key's age wasn't recorded, so it counts from its migration. Otherwise
+	// auto rotation would treat it as infinitely old and replace it on the next tick.
+	ring := &jwsKeyRing{GracePeriod: defaultJwsGracePeriod}
+	if _, err := ring.addKey(certificate, string(privEntry.Value), defaultRSAAlgorithm, time.Now()); err != nil {
+		return nil, errwrap.Wrapf("could not load existing jws keys: {{err}}", err)
+	}
+
+	return ring, nil
+}
+
+// putJwsKeyRing stores the named JWS key ring. Saving the default key also removes any key
+// pair left over from before key rotation existed.
+func putJwsKeyRing(ctx context.Context, s logical.Storage, name string, ring *jwsKeyRing) error {
+	if StrListContains(reservedJwsKeyNames, name) {
+		return fmt.Errorf("%q is reserved and cannot be used as a key name", name)
+	}
+
+	buf, err := json.Marshal(ring)
+	if err != nil {
+		return errwrap.Wrapf("failed to marshal jws key ring: {{err}}", err)
+	}
+
+	if err := s.Put(ctx, &logical.StorageEntry{Key: jwsKeyRingStoragePath(name), Value: buf}); err != nil {
+		return errwrap.Wrapf("could not store jws key ring: {{err}}", err)
+	}
+
+	if name == defaultJwsKeyName {
+		return deleteLegacyJwsKeys(ctx, s)
+	}
+	return nil
+}
+
+// deleteJwsKeyRing removes the named JWS key ring and every key version in it.
+func deleteJwsKeyRing(ctx context.Context, s logical.Storage, name string) error {
+	if err := s.Delete(ctx, jwsKeyRingStoragePath(name)); err != nil {
+		return errwrap.Wrapf("could not delete jws key ring: {{err}}", err)
+	}
+
+	if name == defaultJwsKeyName {
+		return deleteLegacyJwsKeys(ctx, s)
+	}
+	return nil
+}
+
+func deleteLegacyJwsKeys(ctx context.Context, s logical.Storage) error {
+	for _, path := range []string{legacyJwsPrivateKeyPath, legacyJwsCertificatePath} {
+		if err := s.Delete(ctx, path); err != nil {
+			return errwrap.Wrapf("could not remove legacy jws keys: {{err}}", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package webhook
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+// testRotationStart is when the current key of the rings under test was created.
+var testRotationStart = time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// newTestJwsKeyRing returns a ring whose current key was created at testRotationStart.
+func newTestJwsKeyRing(t *testing.T, autoRotatePeriod, gracePeriod time.Duration) *jwsKeyRing {
+	ring := &jwsKeyRing{AutoRotatePeriod: autoRotatePeriod, GracePeriod: gracePeriod}
+	addTestJwsKey(t, ring, false, testRotationStart)
+	return ring
+}
+
+// addTestJwsKey generates a key pair and adds it to ring, as the pending key if stage is set.
+func addTestJwsKey(t *testing.T, ring *jwsKeyRing, stage bool, now time.Time) *jwsKey {
+	privKey, certificate, err := generateKeyPair("ec", 0, "P-256")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var key *jwsKey
+	if stage {
+		key, err = ring.stageKey(certificate, privKey, "ES256", now)
+	} else {
+		key, err = ring.addKey(certificate, privKey, "ES256", now)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestJwsKeyRingPublishAhead(t *testing.T) {
+	for _, tc := range []struct {
+		autoRotatePeriod, gracePeriod time.Duration
+		want                          time.Duration
+	}{
+		{0, 24 * time.Hour, 0},
+		{90 * 24 * time.Hour, 24 * time.Hour, 24 * time.Hour},
+		{48 * time.Hour, 24 * time.Hour, 24 * time.Hour},
+		{2 * time.Hour, 24 * time.Hour, time.Hour},
+		{2 * time.Hour, 0, 0},
+	} {
+		ring := &jwsKeyRing{AutoRotatePeriod: tc.autoRotatePeriod, GracePeriod: tc.gracePeriod}
+		if got := ring.publishAhead(); got != tc.want {
+			t.Errorf("auto_rotate_period %s, grace_period %s: got %s, want %s", tc.autoRotatePeriod, tc.gracePeriod, got, tc.want)
+		}
+	}
+}
+
+func TestJwsKeyRingDue(t *testing.T) {
+	// With a two hour period and a day's grace, the next key is published an hour ahead.
+	const period, grace = 2 * time.Hour, 24 * time.Hour
+
+	for _, tc := range []struct {
+		name             string
+		autoRotatePeriod time.Duration
+		staged           time.Duration // when the pending key was published, after the current key; none if zero
+		now              time.Duration
+		publish, rotate  bool
+	}{
+		{name: "fresh key", autoRotatePeriod: period, now: 0},
+		{name: "before publishing ahead", autoRotatePeriod: period, now: time.Hour - time.Second},
+		{name: "publishing ahead of the period", autoRotatePeriod: period, now: time.Hour, publish: true},
+		{name: "publishing missed ticks", autoRotatePeriod: period, now: 5 * time.Hour, publish: true},
+		{name: "auto rotation disabled", now: 1000 * time.Hour},
+		{name: "pending before the period", autoRotatePeriod: period, staged: time.Hour, now: 2*time.Hour - time.Second},
+		{name: "activating after publication", autoRotatePeriod: period, staged: time.Hour, now: 2 * time.Hour, rotate: true},
+		{name: "published late", autoRotatePeriod: period, staged: 3 * time.Hour, now: 4*time.Hour - time.Second},
+		{name: "activating once published late", autoRotatePeriod: period, staged: 3 * time.Hour, now: 4 * time.Hour, rotate: true},
+	} {
+		ring := newTestJwsKeyRing(t, tc.autoRotatePeriod, grace)
+		if tc.staged != 0 {
+			addTestJwsKey(t, ring, true, testRotationStart.Add(tc.staged))
+		}
+
+		now := testRotationStart.Add(tc.now)
+		if got := ring.dueForPublishing(now); got != tc.publish {
+			t.Errorf("%s: dueForPublishing got %t, want %t", tc.name, got, tc.publish)
+		}
+		if got := ring.dueForRotation(now); got != tc.rotate {
+			t.Errorf("%s: dueForRotation got %t, want %t", tc.name, got, tc.rotate)
+		}
+	}
+}
+
+func TestJwsKeyRingActivatePending(t *testing.T) {
+	ring := newTestJwsKeyRing(t, 2*time.Hour, 24*time.Hour)
+	if ring.pending() != nil {
+		t.Fatal("new ring has a pending key")
+	}
+
+	staged := addTestJwsKey(t, ring, true, testRotationStart.Add(time.Hour))
+	if ring.pending() != staged {
+		t.Fatal("staged key is not pending")
+	}
+	if ring.LatestVersion != 1 {
+		t.Fatalf("staging a key changed the current version to %d", ring.LatestVersion)
+	}
+
+	activated := testRotationStart.Add(2 * time.Hour)
+	ring.activatePending(activated)
+	if ring.current() != staged || ring.LatestVersion != 2 {
+		t.Fatalf("pending key is not current after activation, latest version %d", ring.LatestVersion)
+	}
+	if ring.pending() != nil {
+		t.Fatal("activated key is still pending")
+	}
+	if got, want := ring.Keys[1].RetireTime, activated.Add(24*time.Hour); !got.Equal(want) {
+		t.Fatalf("replaced key retires at %s, want %s", got, want)
+	}
+
+	for _, tc := range []struct {
+		name string
+		now  time.Time
+		want []int
+	}{
+		{"at activation", activated, []int{1, 2}},
+		{"inside the grace period", activated.Add(24*time.Hour - time.Second), []int{1, 2}},
+		{"after the grace period", activated.Add(24 * time.Hour), []int{2}},
+	} {
+		var got []int
+		for _, key := range ring.published(tc.now) {
+			got = append(got, key.Version)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: published versions %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestJwsKeyRingMigratedLegacyKey(t *testing.T) {
+	ctx := context.Background()
+	s := &logical.InmemStorage{}
+
+	privKey, _, err := generateKeyPair("rsa", 2048, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(ctx, &logical.StorageEntry{Key: legacyJwsPrivateKeyPath, Value: []byte(privKey)}); err != nil {
+		t.Fatal(err)
+	}
+
+	before := time.Now()
+	ring, err := getJwsKeyRing(ctx, s, defaultJwsKeyName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ring == nil || ring.LatestVersion != 1 {
+		t.Fatalf("legacy key was not migrated to version 1: %+v", ring)
+	}
+
+	// The legacy key's age is unknown, so it must count from its migration rather than
+	// look long overdue once auto rotation is enabled.
+	migrated := ring.current().CreationTime
+	if migrated.Before(before) || migrated.After(time.Now()) {
+		t.Fatalf("migrated key is dated %s, not from its migration", migrated)
+	}
+
+	ring.AutoRotatePeriod = 2 * time.Hour
+	for _, tc := range []struct {
+		now     time.Duration
+		publish bool
+	}{
+		{0, false},
+		{time.Hour - time.Second, false},
+		{time.Hour, true},
+	} {
+		if got := ring.dueForPublishing(migrated.Add(tc.now)); got != tc.publish {
+			t.Errorf("%s after migration: dueForPublishing got %t, want %t", tc.now, got, tc.publish)
+		}
+		if ring.dueForRotation(migrated.Add(tc.now)) {
+			t.Errorf("%s after migration: due for rotation without a pending key", tc.now)
+		}
+	}
+}
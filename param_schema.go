@@ -0,0 +1,369 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/ryanuber/go-glob"
+)
+
+// numberPrecision is the mantissa size, in bits, numbers are compared with. It keeps
+// integers far beyond int64 exact.
+const numberPrecision = 1024
+
+// Types a parameter schema can require, named as in JSON Schema.
+var parameterTypes = []string{"string", "number", "integer", "boolean", "array", "object"}
+
+// ParameterSchema constrains the value a caller may send for one forwarded parameter.
+type ParameterSchema struct {
+	Required  bool          `json:"required,omitempty"`
+	Type      string        `json:"type,omitempty"`
+	Pattern   string        `json:"pattern,omitempty"`
+	Enum      []interface{} `json:"enum,omitempty"`
+	MinLength *int          `json:"min_length,omitempty"`
+	MaxLength *int          `json:"max_length,omitempty"`
+	Default   interface{}   `json:"default,omitempty"`
+
+	// AllowedValues and DeniedValues are glob patterns ("payments-*") matched against the
+	// value. A denied match wins over an allowed one.
+	AllowedValues []string `json:"allowed_values,omitempty"`
+	DeniedValues  []string `json:"denied_values,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// parameterErrors lists every parameter that failed its schema, so callers can fix them
+// all at once.
+type parameterErrors []string
+
+func (e parameterErrors) Error() string {
+	return "invalid parameters: " + strings.Join(e, "; ")
+}
+
+// parseParameterSchemas reads the param_schema field of a destination, keyed by the
+// lowercased parameter name, and checks that each schema is usable.
+func parseParameterSchemas(raw map[string]interface{}) (map[string]*ParameterSchema, error) {
+	schemas := make(map[string]*ParameterSchema, len(raw))
+
+	for name, value := range raw {
+		buf, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+
+		decoder := json.NewDecoder(bytes.NewReader(buf))
+		decoder.DisallowUnknownFields()
+		decoder.UseNumber()
+
+		var schema ParameterSchema
+		if err := decoder.Decode(&schema); err != nil {
+			return nil, errwrap.Wrapf(fmt.Sprintf("invalid schema for parameter %q: {{err}}", name), err)
+		}
+		if err := schema.compile(); err != nil {
+			return nil, errwrap.Wrapf(fmt.Sprintf("invalid schema for parameter %q: {{err}}", name), err)
+		}
+
+		schemas[strings.ToLower(name)] = &schema
+	}
+
+	return schemas, nil
+}
+
+// compile validates the schema and prepares its pattern.
+func (s *ParameterSchema) compile() error {
+	if s.Type != "" && !StrListContains(parameterTypes, s.Type) {
+		return fmt.Errorf("type must be one of %v", parameterTypes)
+	}
+
+	if s.Pattern != "" {
+		pattern, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return errwrap.Wrapf("invalid pattern: {{err}}", err)
+		}
+		s.pattern = pattern
+	}
+
+	if s.MinLength != nil && *s.MinLength < 0 {
+		return fmt.Errorf("min_length must not be negative")
+	}
+	if s.MinLength != nil && s.MaxLength != nil && *s.MinLength > *s.MaxLength {
+		return fmt.Errorf("min_length must not be greater than max_length")
+	}
+
+	for i, value := range s.Enum {
+		if err := s.checkType(value); err != nil {
+			return fmt.Errorf("enum value %d %s", i, err)
+		}
+	}
+
+	if s.Default != nil {
+		if s.Required {
+			return fmt.Errorf("a required parameter can't have a default")
+		}
+		value, err := s.validate(s.Default)
+		if err != nil {
+			return fmt.Errorf("default %s", err)
+		}
+		s.Default = value
+	}
+
+	return nil
+}
+
+// validate checks a value against the schema and returns it converted to the schema's
+// type. Strings are converted to numbers and booleans, since that is all the CLI sends.
+func (s *ParameterSchema) validate(value interface{}) (interface{}, error) {
+	value = s.coerce(value)
+
+	if err := s.checkType(value); err != nil {
+		return nil, err
+	}
+
+	if s.pattern != nil {
+		str, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("must be a string to match pattern %q", s.Pattern)
+		}
+		if !s.pattern.MatchString(str) {
+			return nil, fmt.Errorf("must match pattern %q", s.Pattern)
+		}
+	}
+
+	if s.MinLength != nil || s.MaxLength != nil {
+		var length int
+		switch v := value.(type) {
+		case string:
+			length = utf8.RuneCountInString(v)
+		case []interface{}:
+			length = len(v)
+		default:
+			return nil, fmt.Errorf("must be a string or an array to have a length")
+		}
+		if s.MinLength != nil && length < *s.MinLength {
+			return nil, fmt.Errorf("must have a length of at least %d", *s.MinLength)
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			return nil, fmt.Errorf("must have a length of at most %d", *s.MaxLength)
+		}
+	}
+
+	if len(s.Enum) > 0 {
+		allowed := false
+		for _, option := range s.Enum {
+			if sameValue(value, option) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			options, _ := json.Marshal(s.Enum)
+			return nil, fmt.Errorf("must be one of %s", options)
+		}
+	}
+
+	if len(s.AllowedValues) > 0 || len(s.DeniedValues) > 0 {
+		text, ok := scalarText(value)
+		if !ok {
+			return nil, fmt.Errorf("must be a string, number or boolean to be matched against allowed or denied values")
+		}
+		for _, pattern := range s.DeniedValues {
+			if glob.Glob(pattern, text) {
+				return nil, fmt.Errorf("value %q is denied", text)
+			}
+		}
+		if len(s.AllowedValues) > 0 && !matchesAnyGlob(s.AllowedValues, text) {
+			return nil, fmt.Errorf("value %q is not allowed, must match one of %q", text, s.AllowedValues)
+		}
+	}
+
+	return value, nil
+}
+
+// scalarText returns the text glob patterns are matched against for strings, numbers and
+// booleans.
+func scalarText(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	case bool:
+		return strconv.FormatBool(v), true
+	default:
+		return "", false
+	}
+}
+
+func matchesAnyGlob(patterns []string, text string) bool {
+	for _, pattern := range patterns {
+		if glob.Glob(pattern, text) {
+			return true
+		}
+	}
+	return false
+}
+
+// coerce converts a string to the number or boolean the schema asks for, if it is one.
+func (s *ParameterSchema) coerce(value interface{}) interface{} {
+	str, ok := value.(string)
+	if !ok {
+		return value
+	}
+
+	switch s.Type {
+	case "number", "integer":
+		if n, ok := parseJSONNumber(str); ok {
+			return n
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(str); err == nil {
+			return b
+		}
+	}
+	return value
+}
+
+// parseJSONNumber returns str as a number if it is exactly one JSON number. Unlike
+// strconv.ParseFloat, it refuses NaN, infinities, hex floats and surrounding text, none
+// of which a target could parse.
+func parseJSONNumber(str string) (json.Number, bool) {
+	decoder := json.NewDecoder(strings.NewReader(str))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return "", false
+	}
+	n, ok := value.(json.Number)
+	if !ok || n.String() != str {
+		return "", false
+	}
+	return n, true
+}
+
+// bigNumber returns the value of a JSON number, exact for integers far beyond int64.
+func bigNumber(n json.Number) (*big.Float, error) {
+	f, _, err := big.ParseFloat(n.String(), 10, numberPrecision, big.ToNearestEven)
+	return f, err
+}
+
+// sameValue reports whether two values, in the form parameterValue returns, are equal.
+// Numbers are compared by value, so 1 matches 1.0 and 1e0.
+func sameValue(a, b interface{}) bool {
+	switch a := a.(type) {
+	case json.Number:
+		b, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		x, errA := bigNumber(a)
+		y, errB := bigNumber(b)
+		if errA != nil || errB != nil {
+			return a == b
+		}
+		return x.Cmp(y) == 0
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !sameValue(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for key, value := range a {
+			other, ok := b[key]
+			if !ok || !sameValue(value, other) {
+				return false
+			}
+		}
+		return true
+	default:
+		return reflect.DeepEqual(a, b)
+	}
+}
+
+// checkType reports whether value, in the form parameterValue returns, has the schema's type.
+func (s *ParameterSchema) checkType(value interface{}) error {
+	var ok bool
+	switch s.Type {
+	case "":
+		return nil
+	case "string":
+		_, ok = value.(string)
+	case "number":
+		_, ok = value.(json.Number)
+	case "integer":
+		var n json.Number
+		if n, ok = value.(json.Number); ok {
+			// Any integral value counts, as in JSON Schema: 1.0, 1e3 and beyond int64.
+			f, err := bigNumber(n)
+			ok = err == nil && f.IsInt()
+		}
+	case "boolean":
+		_, ok = value.(bool)
+	case "array":
+		_, ok = value.([]interface{})
+	case "object":
+		_, ok = value.(map[string]interface{})
+	}
+
+	if !ok {
+		return fmt.Errorf("must be of type %s", s.Type)
+	}
+	return nil
+}
+
+// applyParameterSchemas validates the parameters a caller sent against the destination's
+// schemas and fills in defaults for missing ones. Every failing parameter is reported.
+func applyParameterSchemas(schemas map[string]*ParameterSchema, params map[string]interface{}) error {
+	var names []string
+	for name := range schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs parameterErrors
+	for _, name := range names {
+		schema := schemas[name]
+
+		value, ok := params[name]
+		if !ok {
+			switch {
+			case schema.Required:
+				errs = append(errs, fmt.Sprintf("%s is required", name))
+			case schema.Default != nil:
+				params[name] = schema.Default
+			}
+			continue
+		}
+
+		value, err := schema.validate(value)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s %s", name, err))
+			continue
+		}
+		params[name] = value
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package webhook
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// parseTestSchema parses one parameter schema as it arrives in a destination write.
+func parseTestSchema(t *testing.T, raw string) *ParameterSchema {
+	decoder := json.NewDecoder(strings.NewReader(`{"p": ` + raw + `}`))
+	decoder.UseNumber()
+
+	var schemas map[string]interface{}
+	if err := decoder.Decode(&schemas); err != nil {
+		t.Fatalf("%s: %s", raw, err)
+	}
+	parsed, err := parseParameterSchemas(schemas)
+	if err != nil {
+		t.Fatalf("%s: %s", raw, err)
+	}
+	return parsed["p"]
+}
+
+func TestParameterSchemaValidate(t *testing.T) {
+	for _, tc := range []struct {
+		schema string
+		value  interface{}
+		want   interface{} // nil if the value must be refused
+	}{
+		{`{}`, json.Number("1"), json.Number("1")},
+		{`{}`, "1", "1"},
+
+		{`{"type": "string"}`, "1", "1"},
+		{`{"type": "string"}`, json.Number("1"), nil},
+
+		{`{"type": "number"}`, "1.5", json.Number("1.5")},
+		{`{"type": "number"}`, "-2e-3", json.Number("-2e-3")},
+		{`{"type": "number"}`, " 1", nil},
+		{`{"type": "number"}`, "NaN", nil},
+		{`{"type": "number"}`, "0x10", nil},
+		{`{"type": "number"}`, true, nil},
+
+		{`{"type": "integer"}`, "42", json.Number("42")},
+		{`{"type": "integer"}`, "1.0", json.Number("1.0")},
+		{`{"type": "integer"}`, json.Number("1e3"), json.Number("1e3")},
+		{`{"type": "integer"}`, "-123456789012345678901234567890", json.Number("-123456789012345678901234567890")},
+		{`{"type": "integer"}`, "1.5", nil},
+		{`{"type": "integer"}`, "1e-3", nil},
+		{`{"type": "integer"}`, "forty-two", nil},
+
+		{`{"type": "boolean"}`, "true", true},
+		{`{"type": "boolean"}`, false, false},
+		{`{"type": "boolean"}`, "yes", nil},
+
+		{`{"type": "array"}`, []interface{}{"a"}, []interface{}{"a"}},
+		{`{"type": "object"}`, map[string]interface{}{}, map[string]interface{}{}},
+		{`{"type": "object"}`, []interface{}{}, nil},
+
+		{`{"pattern": "^[a-z]+$"}`, "abc", "abc"},
+		{`{"pattern": "^[a-z]+$"}`, "ABC", nil},
+		{`{"pattern": "^[0-9]+$"}`, json.Number("1"), nil},
+
+		{`{"min_length": 2, "max_length": 5}`, "héllo", "héllo"},
+		{`{"min_length": 2, "max_length": 5}`, "a", nil},
+		{`{"min_length": 2, "max_length": 5}`, "héllo!", nil},
+		{`{"max_length": 1}`, []interface{}{"a", "b"}, nil},
+		{`{"max_length": 1}`, json.Number("1"), nil},
+
+		{`{"type": "number", "enum": [1, 2.5]}`, "1.0", json.Number("1.0")},
+		{`{"type": "number", "enum": [1, 2.5]}`, json.Number("25e-1"), json.Number("25e-1")},
+		{`{"type": "number", "enum": [1, 2.5]}`, "3", nil},
+		{`{"enum": ["a", true]}`, "a", "a"},
+		{`{"enum": ["a", true]}`, "true", nil},
+	} {
+		got, err := parseTestSchema(t, tc.schema).validate(tc.value)
+		switch {
+		case tc.want == nil && err == nil:
+			t.Errorf("%s: expected %#v to be refused, got %#v", tc.schema, tc.value, got)
+		case tc.want != nil && err != nil:
+			t.Errorf("%s: %#v: %s", tc.schema, tc.value, err)
+		case tc.want != nil && !reflect.DeepEqual(got, tc.want):
+			t.Errorf("%s: %#v: got %#v, want %#v", tc.schema, tc.value, got, tc.want)
+		}
+	}
+}
+
+func TestParameterSchemaCoerce(t *testing.T) {
+	for _, tc := range []struct {
+		typ   string
+		value interface{}
+		want  interface{}
+	}{
+		{"", "1", "1"},
+		{"string", "1", "1"},
+		{"number", "1.5", json.Number("1.5")},
+		{"number", "1.5 ", "1.5 "},
+		{"number", "Infinity", "Infinity"},
+		{"integer", "1e3", json.Number("1e3")},
+		{"integer", "1.5", json.Number("1.5")},
+		{"boolean", "false", false},
+		{"boolean", "no", "no"},
+		{"number", true, true},
+		{"boolean", json.Number("1"), json.Number("1")},
+	} {
+		schema := &ParameterSchema{Type: tc.typ}
+		if got := schema.coerce(tc.value); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s %#v: got %#v, want %#v", tc.typ, tc.value, got, tc.want)
+		}
+	}
+}
+
+func TestSameValue(t *testing.T) {
+	for _, tc := range []struct {
+		a, b interface{}
+		want bool
+	}{
+		{json.Number("1"), json.Number("1.0"), true},
+		{json.Number("1"), json.Number("1e0"), true},
+		{json.Number("100"), json.Number("1E2"), true},
+		{json.Number("0.1"), json.Number("1e-1"), true},
+		{json.Number("9007199254740993"), json.Number("9007199254740992"), false},
+		{json.Number("123456789012345678901234567890"), json.Number("123456789012345678901234567891"), false},
+		{json.Number("1"), "1", false},
+		{"a", "a", true},
+		{"a", "b", false},
+		{true, true, true},
+		{true, "true", false},
+		{nil, nil, true},
+		{[]interface{}{json.Number("1"), "a"}, []interface{}{json.Number("1.0"), "a"}, true},
+		{[]interface{}{json.Number("1")}, []interface{}{json.Number("1"), json.Number("1")}, false},
+		{map[string]interface{}{"n": json.Number("2")}, map[string]interface{}{"n": json.Number("2.0")}, true},
+		{map[string]interface{}{"n": json.Number("2")}, map[string]interface{}{"m": json.Number("2")}, false},
+		{map[string]interface{}{}, []interface{}{}, false},
+	} {
+		if got := sameValue(tc.a, tc.b); got != tc.want {
+			t.Errorf("sameValue(%#v, %#v): got %t, want %t", tc.a, tc.b, got, tc.want)
+		}
+		if got := sameValue(tc.b, tc.a); got != tc.want {
+			t.Errorf("sameValue(%#v, %#v): got %t, want %t", tc.b, tc.a, got, tc.want)
+		}
+	}
+}
+
+func TestParameterSchemaGlobs(t *testing.T) {
+	for _, tc := range []struct {
+		schema string
+		value  interface{}
+		ok     bool
+	}{
+		{`{"allowed_values": ["payments-*"]}`, "payments-eu", true},
+		{`{"allowed_values": ["payments-*"]}`, "billing", false},
+		{`{"allowed_values": ["payments-*", "billing"]}`, "billing", true},
+		{`{"allowed_values": ["*"]}`, "", true},
+
+		{`{"denied_values": ["*-prod"]}`, "payments-dev", true},
+		{`{"denied_values": ["*-prod"]}`, "payments-prod", false},
+
+		// A denied match wins over an allowed one.
+		{`{"allowed_values": ["payments-*"], "denied_values": ["payments-prod"]}`, "payments-dev", true},
+		{`{"allowed_values": ["payments-*"], "denied_values": ["payments-prod"]}`, "payments-prod", false},
+		{`{"allowed_values": ["payments-*"], "denied_values": ["payments-prod"]}`, "billing", false},
+		{`{"allowed_values": ["*"], "denied_values": ["*"]}`, "anything", false},
+
+		// Numbers and booleans are matched as the text they were sent as.
+		{`{"allowed_values": ["1*"]}`, json.Number("12"), true},
+		{`{"allowed_values": ["1*"]}`, json.Number("21"), false},
+		{`{"type": "integer", "allowed_values": ["1*"]}`, "12", true},
+		{`{"denied_values": ["-*"]}`, json.Number("-1"), false},
+		{`{"allowed_values": ["true"]}`, true, true},
+		{`{"allowed_values": ["true"]}`, false, false},
+		{`{"type": "boolean", "denied_values": ["false"]}`, "false", false},
+
+		// Other values have no text to match, so they are refused outright.
+		{`{"allowed_values": ["*"]}`, []interface{}{"a"}, false},
+		{`{"denied_values": ["x"]}`, map[string]interface{}{"a": "b"}, false},
+		{`{"allowed_values": ["*"]}`, nil, false},
+	} {
+		_, err := parseTestSchema(t, tc.schema).validate(tc.value)
+		if tc.ok && err != nil {
+			t.Errorf("%s: %#v: %s", tc.schema, tc.value, err)
+		} else if !tc.ok && err == nil {
+			t.Errorf("%s: expected %#v to be refused", tc.schema, tc.value)
+		}
+	}
+}
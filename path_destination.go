@@ -4,8 +4,9 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"path/filepath"
+	"net/http"
 	"strings"
+	"text/template"
 	"time"
 
 	"crypto/x509"
@@ -14,17 +15,114 @@ import (
 	"github.com/hashicorp/go-uuid"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
+	"golang.org/x/net/http/httpguts"
 )
 
 // Destination contains all the operator specified configuration.
 type Destination struct {
-	TargetURL       string            `json:"target_url"`
-	SendEntityID    bool              `json:"send_entity_id"`
-	Timeout         time.Duration     `json:"timeout"`
-	FollowRedirects bool              `json:"follow_redirects"`
-	Parameters      []string          `json:"params"`
-	Metadata        map[string]string `json:"metadata"`
-	TargetCA        []byte            `yaml:"target_ca"`
+	TargetURL             string                      `json:"target_url"`
+	SendEntityID          bool                        `json:"send_entity_id"`
+	SendEntityInfo        bool                        `json:"send_entity_info"`
+	SendTokenInfo         bool                        `json:"send_token_info"`
+	SendRemoteAddr        bool                        `json:"send_remote_address"`
+	ForwardHeaders        []string                    `json:"forward_headers,omitempty"`
+	Timeout               time.Duration               `json:"timeout"`
+	FollowRedirects       bool                        `json:"follow_redirects"`
+	Parameters            []string                    `json:"params"`
+	ParamSchema           map[string]*ParameterSchema `json:"param_schema,omitempty"`
+	Metadata              map[string]string           `json:"metadata"`
+	TargetCA              []byte                      `yaml:"target_ca"`
+	SigningKey            string                      `json:"signing_key"`
+	AdditionalSigningKeys []string                    `json:"additional_signing_keys,omitempty"`
+	JWT                   bool                        `json:"jwt"`
+	Audience              []string                    `json:"audience"`
+	Expiry                time.Duration               `json:"expiry"`
+	DocumentVersion       int                         `json:"document_version,omitempty"`
+	Serialization         string                      `json:"serialization"`
+	SignatureHeaders      []string                    `json:"signature_headers,omitempty"`
+	Format                string                      `json:"format"`
+	CloudEventsMode       string                      `json:"cloudevents_mode"`
+	CloudEventsType       string                      `json:"cloudevents_type"`
+	BodyTemplate          string                      `json:"body_template,omitempty"`
+	BodyContentType       string                      `json:"body_content_type,omitempty"`
+	HMACScheme            string                      `json:"hmac_scheme"`
+	EncryptionAlg         string                      `json:"encryption_algorithm"`
+	EncryptionEnc         string                      `json:"content_encryption"`
+	EncryptionKey         string                      `json:"encryption_key"`
+
+	bodyTemplate *template.Template
+}
+
+// Headers which carry credentials and are never forwarded to a target.
+var sensitiveHeaders = []string{"Authorization", "Cookie", "Proxy-Authorization", "X-Vault-Token"}
+
+// signingKey returns the name of the JWS key the destination signs with. Destinations
+// written before named keys existed use the default key.
+func (d *Destination) signingKey() string {
+	if d.SigningKey == "" {
+		return defaultJwsKeyName
+	}
+	return d.SigningKey
+}
+
+// serialization returns the JWS serialization the destination is sent.
+func (d *Destination) serialization() string {
+	switch {
+	case d.Serialization != "":
+		return d.Serialization
+	case d.JWT:
+		return serializationCompact
+	case d.signedInHeader():
+		return serializationDetached
+	default:
+		return serializationGeneral
+	}
+}
+
+// signedInHeader reports whether the body is sent as is, with any signature in a header.
+func (d *Destination) signedInHeader() bool {
+	return d.BodyTemplate != "" || d.format() == formatCloudEvents
+}
+
+// bodyContentType returns the Content-Type of templated bodies.
+func (d *Destination) bodyContentType() string {
+	if d.BodyContentType == "" {
+		return defaultBodyContentType
+	}
+	return d.BodyContentType
+}
+
+// documentVersion returns the version of the document sent. Destinations written before
+// documents had versions get version 1, the original document they were already sent.
+func (d *Destination) documentVersion() int {
+	if d.DocumentVersion == 0 {
+		return documentVersion1
+	}
+	return d.DocumentVersion
+}
+
+// format returns the shape the document is sent in.
+func (d *Destination) format() string {
+	if d.Format == "" {
+		return formatDocument
+	}
+	return d.Format
+}
+
+// cloudEventsMode returns the CloudEvents HTTP content mode.
+func (d *Destination) cloudEventsMode() string {
+	if d.CloudEventsMode == "" {
+		return cloudEventsStructured
+	}
+	return d.CloudEventsMode
+}
+
+// cloudEventsType returns the CloudEvents type attribute.
+func (d *Destination) cloudEventsType() string {
+	if d.CloudEventsType == "" {
+		return defaultCloudEventsType
+	}
+	return d.CloudEventsType
 }
 
 func pathDestination(b *backend) *framework.Path {
@@ -79,6 +177,25 @@ func pathConfigDestination(b *backend) *framework.Path {
 				Description: "", // TODO
 				Default:     true,
 			},
+			"send_entity_info": {
+				Type:        framework.TypeBool,
+				Description: `Send the name and aliases of the caller's identity entity.`,
+				Default:     false,
+			},
+			"send_token_info": {
+				Type:        framework.TypeBool,
+				Description: `Send the display name, HMAC'd accessor and remaining uses of the caller's token.`,
+				Default:     false,
+			},
+			"send_remote_address": {
+				Type:        framework.TypeBool,
+				Description: `Send the network address the caller connected from.`,
+				Default:     false,
+			},
+			"forward_headers": {
+				Type:        framework.TypeCommaStringSlice,
+				Description: `Request headers of the caller to send. Vault only passes on headers listed in the mount's passthrough_request_headers.`,
+			},
 			"timeout": {
 				Type:        framework.TypeDurationSecond,
 				Description: "", // TODO
@@ -88,6 +205,10 @@ func pathConfigDestination(b *backend) *framework.Path {
 				Type:        framework.TypeString,
 				Description: "", // TODO
 			},
+			"param_schema": {
+				Type:        framework.TypeMap,
+				Description: `Schema each forwarded parameter must match, keyed by parameter name.`,
+			},
 			"metadata": {
 				Type:        framework.TypeKVPairs,
 				Description: "", // TODO
@@ -97,6 +218,83 @@ func pathConfigDestination(b *backend) *framework.Path {
 				Description: "", // TODO
 				Default:     false,
 			},
+			"signing_key": {
+				Type:        framework.TypeString,
+				Description: `Name of the JWS key documents are signed with.`,
+				Default:     defaultJwsKeyName,
+			},
+			"additional_signing_keys": {
+				Type:        framework.TypeCommaStringSlice,
+				Description: `Names of further JWS keys documents are also signed with. Requires the general serialization.`,
+			},
+			"jwt": {
+				Type:        framework.TypeBool,
+				Description: `Send the document as a compact JWT with the standard registered claims.`,
+				Default:     false,
+			},
+			"audience": {
+				Type:        framework.TypeCommaStringSlice,
+				Description: `Value(s) of the JWT "aud" claim. Defaults to the destination name.`,
+			},
+			"expiry": {
+				Type:        framework.TypeDurationSecond,
+				Description: `How long after it is issued the JWT expires.`,
+				Default:     300,
+			},
+			"document_version": {
+				Type:        framework.TypeInt,
+				Description: `Version of the document sent, for targets that have not migrated to the latest one yet.`,
+				Default:     latestDocumentVersion,
+			},
+			"serialization": {
+				Type:        framework.TypeLowerCaseString,
+				Description: `JWS serialization: general, flattened, compact, detached, none or http-signature. Defaults to general, or compact for JWTs.`,
+			},
+			"signature_headers": {
+				Type:        framework.TypeCommaStringSlice,
+				Description: `Request headers signed along with the method, target URI, Content-Digest and Content-Type by the http-signature serialization.`,
+			},
+			"format": {
+				Type:        framework.TypeLowerCaseString,
+				Description: `Shape of the request: document or cloudevents. Defaults to document.`,
+			},
+			"cloudevents_mode": {
+				Type:        framework.TypeLowerCaseString,
+				Description: `CloudEvents HTTP content mode: structured or binary. Defaults to structured.`,
+			},
+			"cloudevents_type": {
+				Type:        framework.TypeString,
+				Description: `CloudEvents type attribute. Defaults to ` + defaultCloudEventsType + `.`,
+			},
+			"body_template": {
+				Type:        framework.TypeString,
+				Description: `Go text/template rendering the request body from the document, signed in a header.`,
+			},
+			"body_content_type": {
+				Type:        framework.TypeString,
+				Description: `Content-Type of bodies rendered by body_template. Defaults to ` + defaultBodyContentType + `.`,
+			},
+			"hmac_scheme": {
+				Type:        framework.TypeLowerCaseString,
+				Description: `Also sign the body with a shared secret: github or standard-webhooks.`,
+			},
+			"hmac_secret": {
+				Type:        framework.TypeString,
+				Description: `Shared secret for hmac_scheme. Write only.`,
+			},
+			"encryption_algorithm": {
+				Type:        framework.TypeString,
+				Description: `Encrypt the signed document to the target with JWE: RSA-OAEP-256 or ECDH-ES.`,
+			},
+			"content_encryption": {
+				Type:        framework.TypeString,
+				Description: `JWE content encryption: A128GCM, A192GCM or A256GCM.`,
+				Default:     "A256GCM",
+			},
+			"encryption_key": {
+				Type:        framework.TypeString,
+				Description: `PEM encoded public key or certificate of the target, used with encryption_algorithm.`,
+			},
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -131,6 +329,38 @@ func (b *backend) createDestination(data *framework.FieldData) (*Destination, er
 	}
 	d.SendEntityID = sendEntity.(bool)
 
+	sendEntityInfo, err := getFieldValue("send_entity_info", data)
+	if err != nil {
+		return nil, err
+	}
+	d.SendEntityInfo = sendEntityInfo.(bool)
+
+	sendTokenInfo, err := getFieldValue("send_token_info", data)
+	if err != nil {
+		return nil, err
+	}
+	d.SendTokenInfo = sendTokenInfo.(bool)
+
+	sendRemoteAddr, err := getFieldValue("send_remote_address", data)
+	if err != nil {
+		return nil, err
+	}
+	d.SendRemoteAddr = sendRemoteAddr.(bool)
+
+	forwardHeaders, err := getFieldValue("forward_headers", data)
+	if err != nil {
+		return nil, err
+	}
+	for _, header := range forwardHeaders.([]string) {
+		header = http.CanonicalHeaderKey(header)
+		if StrListContains(sensitiveHeaders, header) {
+			return nil, fmt.Errorf("header %s carries credentials and can't be forwarded", header)
+		}
+		if !StrListContains(d.ForwardHeaders, header) {
+			d.ForwardHeaders = append(d.ForwardHeaders, header)
+		}
+	}
+
 	timeout, err := getFieldValue("timeout", data)
 	if err != nil {
 		return nil, err
@@ -156,12 +386,219 @@ func (b *backend) createDestination(data *framework.FieldData) (*Destination, er
 		}
 	}
 
+	paramSchema, err := getFieldValue("param_schema", data)
+	if err != nil {
+		return nil, err
+	}
+	if schemas := paramSchema.(map[string]interface{}); len(schemas) > 0 {
+		d.ParamSchema, err = parseParameterSchemas(schemas)
+		if err != nil {
+			return nil, err
+		}
+		// A parameter with a schema is always forwarded.
+		for key := range d.ParamSchema {
+			if !StrListContains(d.Parameters, key) {
+				d.Parameters = append(d.Parameters, key)
+			}
+		}
+	}
+
 	metadata, err := getFieldValue("metadata", data)
 	if err != nil {
 		return nil, err
 	}
 	d.Metadata = metadata.(map[string]string)
 
+	signingKey, err := getFieldValue("signing_key", data)
+	if err != nil {
+		return nil, err
+	}
+	d.SigningKey = signingKey.(string)
+
+	jwt, err := getFieldValue("jwt", data)
+	if err != nil {
+		return nil, err
+	}
+	d.JWT = jwt.(bool)
+
+	audience, err := getFieldValue("audience", data)
+	if err != nil {
+		return nil, err
+	}
+	d.Audience = audience.([]string)
+
+	expiry, err := getFieldValue("expiry", data)
+	if err != nil {
+		return nil, err
+	}
+	d.Expiry = time.Duration(expiry.(int)) * time.Second
+	if d.JWT && d.Expiry <= 0 {
+		return nil, fmt.Errorf("expiry must be positive")
+	}
+
+	documentVersion, err := getFieldValue("document_version", data)
+	if err != nil {
+		return nil, err
+	}
+	d.DocumentVersion = documentVersion.(int)
+	if d.DocumentVersion < documentVersion1 || d.DocumentVersion > latestDocumentVersion {
+		return nil, fmt.Errorf("document_version must be one of %v", documentVersions)
+	}
+	if d.DocumentVersion < documentVersion2 && (d.SendEntityInfo || d.SendTokenInfo || d.SendRemoteAddr || len(d.ForwardHeaders) > 0) {
+		return nil, fmt.Errorf("send_entity_info, send_token_info, send_remote_address and forward_headers require document_version %d", documentVersion2)
+	}
+
+	serialization, err := getFieldValue("serialization", data)
+	if err != nil {
+		return nil, err
+	}
+	d.Serialization = serialization.(string)
+	if d.Serialization != "" && !StrListContains(serializations, d.Serialization) {
+		return nil, fmt.Errorf("serialization must be one of %v", serializations)
+	}
+	if d.JWT && d.serialization() != serializationCompact {
+		return nil, fmt.Errorf("JWTs only support the compact serialization")
+	}
+
+	signatureHeaders, err := getFieldValue("signature_headers", data)
+	if err != nil {
+		return nil, err
+	}
+	for _, header := range signatureHeaders.([]string) {
+		header = strings.ToLower(header)
+		if strings.HasPrefix(header, "@") {
+			return nil, fmt.Errorf("signature_headers only takes header names, not %s", header)
+		}
+		if !httpguts.ValidHeaderFieldName(header) {
+			return nil, fmt.Errorf("signature_headers: %q is not a valid header name", header)
+		}
+		if !StrListContains(httpSignatureComponents, header) && !StrListContains(d.SignatureHeaders, header) {
+			d.SignatureHeaders = append(d.SignatureHeaders, header)
+		}
+	}
+	if len(d.SignatureHeaders) > 0 && d.serialization() != serializationHTTPSignature {
+		return nil, fmt.Errorf("signature_headers requires the http-signature serialization")
+	}
+
+	format, err := getFieldValue("format", data)
+	if err != nil {
+		return nil, err
+	}
+	d.Format = format.(string)
+	if d.Format != "" && !StrListContains(formats, d.Format) {
+		return nil, fmt.Errorf("format must be one of %v", formats)
+	}
+
+	cloudEventsMode, err := getFieldValue("cloudevents_mode", data)
+	if err != nil {
+		return nil, err
+	}
+	d.CloudEventsMode = cloudEventsMode.(string)
+	if d.CloudEventsMode != "" && !StrListContains(cloudEventsModes, d.CloudEventsMode) {
+		return nil, fmt.Errorf("cloudevents_mode must be one of %v", cloudEventsModes)
+	}
+
+	cloudEventsType, err := getFieldValue("cloudevents_type", data)
+	if err != nil {
+		return nil, err
+	}
+	d.CloudEventsType = cloudEventsType.(string)
+
+	bodyTemplate, err := getFieldValue("body_template", data)
+	if err != nil {
+		return nil, err
+	}
+	d.BodyTemplate = bodyTemplate.(string)
+	if d.BodyTemplate != "" {
+		if d.format() == formatCloudEvents {
+			return nil, fmt.Errorf("body_template can't be used with cloud events")
+		}
+		d.bodyTemplate, err = parseBodyTemplate(d.BodyTemplate)
+		if err != nil {
+			return nil, errwrap.Wrapf("invalid body_template: {{err}}", err)
+		}
+	}
+
+	bodyContentType, err := getFieldValue("body_content_type", data)
+	if err != nil {
+		return nil, err
+	}
+	d.BodyContentType = bodyContentType.(string)
+
+	if d.signedInHeader() {
+		if d.JWT {
+			return nil, fmt.Errorf("cloud events and templated bodies can't be sent as JWTs")
+		}
+		// The body has to be sent as is, so the signature can only travel in a header.
+		switch d.serialization() {
+		case serializationDetached, serializationNone, serializationHTTPSignature:
+		default:
+			return nil, fmt.Errorf("cloud events and templated bodies require the detached, none or http-signature serialization")
+		}
+	}
+
+	additionalSigningKeys, err := getFieldValue("additional_signing_keys", data)
+	if err != nil {
+		return nil, err
+	}
+	d.AdditionalSigningKeys = additionalSigningKeys.([]string)
+	if len(d.AdditionalSigningKeys) > 0 && d.serialization() != serializationGeneral {
+		return nil, fmt.Errorf("additional_signing_keys requires the general serialization")
+	}
+	if StrListContains(d.AdditionalSigningKeys, d.signingKey()) {
+		return nil, fmt.Errorf("additional_signing_keys must not include signing_key %q", d.signingKey())
+	}
+
+	hmacScheme, err := getFieldValue("hmac_scheme", data)
+	if err != nil {
+		return nil, err
+	}
+	d.HMACScheme = hmacScheme.(string)
+	if d.HMACScheme != "" && !StrListContains(hmacSchemes, d.HMACScheme) {
+		return nil, fmt.Errorf("hmac_scheme must be one of %v", hmacSchemes)
+	}
+	if d.serialization() == serializationNone && d.HMACScheme == "" {
+		return nil, fmt.Errorf("serialization none sends an unsigned document and requires hmac_scheme")
+	}
+
+	encryptionAlg, err := getFieldValue("encryption_algorithm", data)
+	if err != nil {
+		return nil, err
+	}
+	d.EncryptionAlg = encryptionAlg.(string)
+
+	encryptionEnc, err := getFieldValue("content_encryption", data)
+	if err != nil {
+		return nil, err
+	}
+	d.EncryptionEnc = encryptionEnc.(string)
+
+	encryptionKey, err := getFieldValue("encryption_key", data)
+	if err != nil {
+		return nil, err
+	}
+	d.EncryptionKey = encryptionKey.(string)
+
+	if d.EncryptionAlg != "" {
+		if !StrListContains(jweAlgorithms, d.EncryptionAlg) {
+			return nil, fmt.Errorf("encryption_algorithm must be one of %v", jweAlgorithms)
+		}
+		if _, ok := jweEncryptions[d.EncryptionEnc]; !ok {
+			return nil, fmt.Errorf("unsupported content_encryption %q", d.EncryptionEnc)
+		}
+		if d.serialization() == serializationDetached || d.serialization() == serializationNone || d.serialization() == serializationHTTPSignature {
+			return nil, fmt.Errorf("encryption requires the signed document in the body, not serialization %s", d.serialization())
+		}
+
+		pub, err := parsePublicKeyPEM([]byte(d.EncryptionKey))
+		if err != nil {
+			return nil, errwrap.Wrapf("could not parse encryption_key: {{err}}", err)
+		}
+		if err := validateEncryptionKey(d.EncryptionAlg, pub); err != nil {
+			return nil, err
+		}
+	}
+
 	targetCA, err := getFieldValue("target_ca", data)
 	if err != nil {
 		return nil, err
@@ -188,6 +625,43 @@ func (b *backend) pathWriteDestination(ctx context.Context, req *logical.Request
 		return nil, errwrap.Wrapf("failed to create destination: {{err}}", err)
 	}
 
+	// The key can still be rotated to another algorithm later, which fails when sending.
+	if d.serialization() == serializationHTTPSignature {
+		ring, err := getJwsKeyRing(ctx, req.Storage, d.signingKey())
+		if err != nil {
+			return nil, err
+		}
+		if ring != nil {
+			if _, ok := httpSignatureAlgorithms[ring.current().algorithm()]; !ok {
+				return nil, fmt.Errorf("jws key %q signs with %s, which has no HTTP message signature equivalent, use one of %v", d.signingKey(), ring.current().algorithm(), httpSignatureAlgorithmNames())
+			}
+		}
+	}
+
+	name := data.Get("target_name").(string)
+
+	secrets, err := getDestinationSecrets(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if secrets == nil {
+		secrets = &destinationSecrets{}
+	}
+
+	hmacSecret, hmacSecretChanged := data.GetOk("hmac_secret")
+	if hmacSecretChanged {
+		secrets.HMACSecret = hmacSecret.(string)
+	}
+
+	if d.HMACScheme != "" {
+		if secrets.HMACSecret == "" {
+			return nil, fmt.Errorf("hmac_scheme requires hmac_secret")
+		}
+		if _, err := hmacKey(d.HMACScheme, secrets.HMACSecret); err != nil {
+			return nil, err
+		}
+	}
+
 	buf, err := json.Marshal(d)
 	if err != nil {
 		return nil, errwrap.Wrapf("failed to create destination: {{err}}", err)
@@ -200,8 +674,31 @@ func (b *backend) pathWriteDestination(ctx context.Context, req *logical.Request
 	if err := req.Storage.Put(ctx, entry); err != nil {
 		return nil, errwrap.Wrapf("failed to write: {{err}}", err)
 	}
+	b.invalidate(ctx, req.Path)
+
+	// Written after the destination, so a failed write doesn't leave a secret behind for a
+	// destination that doesn't exist.
+	if hmacSecretChanged {
+		if err := putDestinationSecrets(ctx, req.Storage, name, secrets); err != nil {
+			return nil, err
+		}
+	}
 
-	return &logical.Response{}, nil
+	resp := &logical.Response{}
+
+	// dual_sign is set on the key, so it can't be refused here, but it would otherwise be
+	// ignored without a word.
+	if d.serialization() != serializationGeneral {
+		ring, err := getJwsKeyRing(ctx, req.Storage, d.signingKey())
+		if err != nil {
+			return nil, err
+		}
+		if ring != nil && ring.DualSign {
+			resp.AddWarning(fmt.Sprintf("jws key %q has dual_sign set, which only applies to the general serialization, documents sent as %s are signed by its current key alone", d.signingKey(), d.serialization()))
+		}
+	}
+
+	return resp, nil
 }
 
 func (b *backend) pathReadDestination(ctx context.Context, req *logical.Request, data *framework.FieldData) (response *logical.Response, retErr error) {
@@ -216,17 +713,45 @@ func (b *backend) pathReadDestination(ctx context.Context, req *logical.Request,
 		return nil, errwrap.Wrapf("failed to unmarshal destination: {{err}}", err)
 	}
 
+	secrets, err := getDestinationSecrets(ctx, req.Storage, data.Get("target_name").(string))
+	if err != nil {
+		return nil, err
+	}
+
 	timeout := fmt.Sprintf("%v", d.Timeout)
 
 	return &logical.Response{
 		Data: map[string]interface{}{
-			"target_url":       d.TargetURL,
-			"send_entity_id":   d.SendEntityID,
-			"timeout":          timeout,
-			"follow_redirects": d.FollowRedirects,
-			"params":           d.Parameters,
-			"metadata":         d.Metadata,
-			"target_ca":        d.TargetCA,
+			"target_url":              d.TargetURL,
+			"send_entity_id":          d.SendEntityID,
+			"send_entity_info":        d.SendEntityInfo,
+			"send_token_info":         d.SendTokenInfo,
+			"send_remote_address":     d.SendRemoteAddr,
+			"forward_headers":         d.ForwardHeaders,
+			"timeout":                 timeout,
+			"follow_redirects":        d.FollowRedirects,
+			"params":                  d.Parameters,
+			"param_schema":            d.ParamSchema,
+			"metadata":                d.Metadata,
+			"target_ca":               d.TargetCA,
+			"signing_key":             d.signingKey(),
+			"additional_signing_keys": d.AdditionalSigningKeys,
+			"jwt":                     d.JWT,
+			"audience":                d.Audience,
+			"expiry":                  fmt.Sprintf("%v", d.Expiry),
+			"document_version":        d.documentVersion(),
+			"serialization":           d.serialization(),
+			"signature_headers":       d.SignatureHeaders,
+			"format":                  d.format(),
+			"cloudevents_mode":        d.cloudEventsMode(),
+			"cloudevents_type":        d.cloudEventsType(),
+			"body_template":           d.BodyTemplate,
+			"body_content_type":       d.bodyContentType(),
+			"hmac_scheme":             d.HMACScheme,
+			"encryption_algorithm":    d.EncryptionAlg,
+			"content_encryption":      d.EncryptionEnc,
+			"encryption_key":          d.EncryptionKey,
+			"hmac_secret_set":         secrets != nil && secrets.HMACSecret != "",
 		},
 	}, nil
 }
@@ -236,7 +761,12 @@ func (b *backend) pathDeleteDestination(ctx context.Context, req *logical.Reques
 	b.Lock.Lock()
 	defer b.Lock.Unlock()
 
+	if err := req.Storage.Delete(ctx, destinationSecretsPrefix+data.Get("target_name").(string)); err != nil {
+		return nil, err
+	}
+
 	err := req.Storage.Delete(ctx, req.Path)
+	b.invalidate(ctx, req.Path)
 	return nil, err
 }
 
@@ -271,7 +801,7 @@ func (b *backend) pathListDestinations(ctx context.Context, req *logical.Request
 	return logical.ListResponse(elements), nil
 }
 
-func (b *backend) buildDocument(destination *Destination, req *logical.Request, data *framework.FieldData) (*Document, error) {
+func (b *backend) buildDocument(ctx context.Context, destination *Destination, req *logical.Request, data *framework.FieldData) (*Document, error) {
 	// Build Document
 	var document Document
 
@@ -280,72 +810,276 @@ func (b *backend) buildDocument(destination *Destination, req *logical.Request,
 		return nil, errwrap.Wrapf("failed to generate nonce: {{err}}", err)
 	}
 
+	document.Version = destination.documentVersion()
 	document.Nonce = nonce
 	document.Path = data.Get("target_name").(string)
 	if destination.SendEntityID {
 		document.EntityID = req.EntityID
 	}
+	if destination.SendEntityInfo && req.EntityID != "" {
+		entity, err := b.System().EntityInfo(req.EntityID)
+		if err != nil {
+			return nil, errwrap.Wrapf("could not look up entity: {{err}}", err)
+		}
+		if entity != nil {
+			document.Entity = newEntityInfo(entity)
+		}
+	}
+	if destination.SendTokenInfo {
+		document.Token = &TokenInfo{
+			DisplayName:   req.DisplayName,
+			RemainingUses: req.ClientTokenRemainingUses,
+		}
+		if req.ClientTokenAccessor != "" {
+			sa, err := b.getSalt(ctx, req.Storage)
+			if err != nil {
+				return nil, errwrap.Wrapf("could not get salt: {{err}}", err)
+			}
+			document.Token.AccessorHMAC = sa.GetIdentifiedHMAC(req.ClientTokenAccessor)
+		}
+	}
+	if destination.SendRemoteAddr && req.Connection != nil {
+		document.RemoteAddr = req.Connection.RemoteAddr
+	}
+	for _, header := range destination.ForwardHeaders {
+		if values := http.Header(req.Headers)[header]; len(values) > 0 {
+			if document.Headers == nil {
+				document.Headers = make(map[string][]string)
+			}
+			document.Headers[header] = values
+		}
+	}
 	document.Timestamp = time.Now().Unix()
 	document.RequestID = req.ID
 	if destination.Metadata != nil {
 		document.Metadata = destination.Metadata
 	}
 
-	document.Parameters = make(map[string]string)
+	document.Parameters = make(map[string]interface{})
 	for k, v := range data.Raw {
 		lowKey := strings.ToLower(k)
 		if StrListContains(destination.Parameters, lowKey) {
-			document.Parameters[lowKey] = v.(string)
+			value, err := parameterValue(v)
+			if err != nil {
+				return nil, errwrap.Wrapf(fmt.Sprintf("invalid value for parameter %q: {{err}}", lowKey), err)
+			}
+			document.Parameters[lowKey] = value
 		}
 	}
 
+	if err := applyParameterSchemas(destination.ParamSchema, document.Parameters); err != nil {
+		return nil, err
+	}
+
 	return &document, nil
 }
 
-func (b *backend) pathContactDestination(ctx context.Context, req *logical.Request, data *framework.FieldData) (response *logical.Response, retErr error) {
-	b.Logger().Debug("pathContactDestination", "ctx", ctx, "req", req, "data", data)
-	b.Lock.RLock()
-	defer b.Lock.RUnlock()
+// signers returns the keys documents sent to the destination are signed with, the
+// current key of signing_key first.
+func (b *backend) signers(ctx context.Context, s logical.Storage, destination *Destination) ([]*parsedJwsKey, error) {
+	var keys []*parsedJwsKey
+	for _, name := range append([]string{destination.signingKey()}, destination.AdditionalSigningKeys...) {
+		ring, err := b.getSigningKeys(ctx, s, name)
+		if err != nil {
+			return nil, err
+		}
 
-	entry, _ := req.Storage.Get(ctx, filepath.ToSlash(filepath.Join("config", req.Path)))
+		if ring == nil {
+			return nil, fmt.Errorf("incomplete cryptographic configuration, set jws key %q", name)
+		}
+		keys = append(keys, ring.signers(time.Now())...)
+	}
+	return keys, nil
+}
 
-	destination, err := entryToDestination(entry)
-	if err != nil {
-		return nil, errwrap.Wrapf("failed to unmarshal destination: {{err}}", err)
+// signDocument serializes and signs the document the way the destination asks for,
+// returning the HTTP body and headers to send to the target.
+func (b *backend) signDocument(ctx context.Context, req *logical.Request, destination *Destination, document *Document) ([]byte, http.Header, error) {
+	var bytesOut []byte
+	headers := http.Header{}
+
+	if destination.signedInHeader() {
+		var err error
+		if destination.BodyTemplate != "" {
+			bytesOut, headers, err = destination.renderBody(*document)
+		} else {
+			event := newCloudEvent(*document, req.MountPoint, destination.cloudEventsType())
+			bytesOut, headers, err = serializeCloudEvent(event, destination.cloudEventsMode())
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if destination.serialization() == serializationDetached {
+			keys, err := b.signers(ctx, req.Storage, destination)
+			if err != nil {
+				return nil, nil, err
+			}
+			signature, err := signDetached(bytesOut, keys[0])
+			if err != nil {
+				return nil, nil, errwrap.Wrapf("could not sign body: {{err}}", err)
+			}
+			headers.Set(detachedSignatureHeader, signature)
+		}
+	} else if destination.serialization() == serializationNone || destination.serialization() == serializationHTTPSignature {
+		buf, err := json.Marshal(document)
+		if err != nil {
+			return nil, nil, errwrap.Wrapf("could not marshal document: {{err}}", err)
+		}
+		bytesOut = buf
+		headers.Set("Content-Type", "application/json")
+	} else {
+		keys, err := b.signers(ctx, req.Storage, destination)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if destination.JWT {
+			audience := destination.Audience
+			if len(audience) == 0 {
+				audience = []string{document.Path}
+			}
+
+			claims, err := document.claims(strings.TrimSuffix(req.MountPoint, "/"), audience, destination.Expiry)
+			if err != nil {
+				return nil, nil, errwrap.Wrapf("could not build claims: {{err}}", err)
+			}
+			bytesOut, err = serializeJWT(claims, keys[0])
+			if err != nil {
+				return nil, nil, errwrap.Wrapf("could not marshal document: {{err}}", err)
+			}
+		} else {
+			bytesOut, headers, err = serializeDocument(*document, destination.serialization(), keys)
+			if err != nil {
+				return nil, nil, errwrap.Wrapf("could not marshal document: {{err}}", err)
+			}
+		}
 	}
 
-	// TODO Should we cache this?
-	storageEntry, err := req.Storage.Get(ctx, "config/keys/jws/private_key")
+	if destination.EncryptionAlg != "" {
+		pub, err := parsePublicKeyPEM([]byte(destination.EncryptionKey))
+		if err != nil {
+			return nil, nil, errwrap.Wrapf("could not parse encryption_key: {{err}}", err)
+		}
 
-	if err != nil {
-		return nil, errwrap.Wrapf("could not get jws private_key: {{err}}", err)
+		cty := "JOSE+JSON"
+		if destination.serialization() == serializationCompact {
+			cty = "JOSE"
+		}
+		if destination.JWT {
+			cty = "JWT"
+		}
+
+		bytesOut, err = encryptJWE(bytesOut, destination.EncryptionAlg, destination.EncryptionEnc, cty, pub)
+		if err != nil {
+			return nil, nil, errwrap.Wrapf("could not encrypt document: {{err}}", err)
+		}
+		headers.Set("Content-Type", "application/jose")
+	}
+
+	if destination.HMACScheme != "" {
+		secrets, err := getDestinationSecrets(ctx, req.Storage, document.Path)
+		if err != nil {
+			return nil, nil, err
+		}
+		if secrets == nil || secrets.HMACSecret == "" {
+			return nil, nil, fmt.Errorf("incomplete configuration, set hmac_secret")
+		}
+
+		hmacHeaders, err := hmacHeaders(destination.HMACScheme, secrets.HMACSecret, document.Nonce, document.Timestamp, bytesOut)
+		if err != nil {
+			return nil, nil, errwrap.Wrapf("could not sign document: {{err}}", err)
+		}
+		for name, values := range hmacHeaders {
+			headers[name] = values
+		}
 	}
 
-	if storageEntry == nil {
-		return nil, fmt.Errorf("incomplete cryptographic configuration, set jws keys")
+	// Signed last, so the signature can cover the headers added above.
+	if destination.serialization() == serializationHTTPSignature {
+		keys, err := b.signers(ctx, req.Storage, destination)
+		if err != nil {
+			return nil, nil, err
+		}
+		err = signHTTPMessage(http.MethodPost, destination.TargetURL, bytesOut, headers, destination.SignatureHeaders, document.Nonce, time.Unix(document.Timestamp, 0), keys[0])
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return bytesOut, headers, nil
+}
+
+// contactRequest is everything needed to send a signed document, copied out of the
+// destination so the request can be made without holding the backend lock.
+type contactRequest struct {
+	url             string
+	body            []byte
+	headers         http.Header
+	nonce           string
+	followRedirects bool
+	timeout         time.Duration
+	targetCA        []byte
+}
+
+// prepareContact builds and signs the document for the named destination.
+func (b *backend) prepareContact(ctx context.Context, req *logical.Request, data *framework.FieldData) (*contactRequest, error) {
+	b.Lock.RLock()
+	defer b.Lock.RUnlock()
+
+	destination, err := b.getDestination(ctx, req.Storage, data.Get("target_name").(string))
+	if err != nil {
+		return nil, errwrap.Wrapf("failed to get destination: {{err}}", err)
+	}
+	if destination == nil {
+		return nil, fmt.Errorf("destination %q does not exist", data.Get("target_name").(string))
 	}
 
-	document, err := b.buildDocument(destination, req, data)
+	document, err := b.buildDocument(ctx, destination, req, data)
+	if errs, ok := err.(parameterErrors); ok {
+		return nil, logical.CodedError(http.StatusBadRequest, errs.Error())
+	}
 	if err != nil {
 		return nil, errwrap.Wrapf("could not build document: {{err}}", err)
 	}
 
-	bytesOut, err := serializeDocument(*document, storageEntry.Value)
+	bytesOut, headers, err := b.signDocument(ctx, req, destination, document)
+	if err != nil {
+		return nil, err
+	}
+
+	return &contactRequest{
+		url:             destination.TargetURL,
+		body:            bytesOut,
+		headers:         headers,
+		nonce:           document.Nonce,
+		followRedirects: destination.FollowRedirects,
+		timeout:         destination.Timeout,
+		targetCA:        destination.TargetCA,
+	}, nil
+}
+
+func (b *backend) pathContactDestination(ctx context.Context, req *logical.Request, data *framework.FieldData) (response *logical.Response, retErr error) {
+	b.Logger().Debug("pathContactDestination", "ctx", ctx, "req", req, "data", data)
+
+	// The lock is released before the request is sent, so a slow target can't hold up
+	// writes to the backend.
+	contact, err := b.prepareContact(ctx, req, data)
 	if err != nil {
-		return nil, errwrap.Wrapf("could not marshal document: {{err}}", err)
+		return nil, err
 	}
 
 	verifyNonce := &logical.StorageEntry{
-		Key:   "verify/" + document.Nonce,
-		Value: bytesOut,
+		Key:   "verify/" + contact.nonce,
+		Value: contact.body,
 	}
 	if err := req.Storage.Put(ctx, verifyNonce); err != nil {
 		return nil, errwrap.Wrapf("could not store nonce verification: {{err}}", err)
 	}
 
-	defer req.Storage.Delete(ctx, "verify/"+document.Nonce)
+	defer req.Storage.Delete(ctx, "verify/"+contact.nonce)
 
-	bytesIn, err := sendRequest(destination.TargetURL, bytesOut, destination.FollowRedirects, destination.Timeout, destination.TargetCA)
+	bytesIn, err := sendRequest(contact.url, contact.body, contact.headers, contact.followRedirects, contact.timeout, contact.targetCA)
 
 	if err != nil {
 		return nil, errwrap.Wrapf("could not process request: {{err}}", err)
@@ -0,0 +1,70 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathDocumentSchemas(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: `document/schema/?$`,
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathReadDocumentSchemas,
+		},
+	}
+}
+
+func pathDocumentSchema(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: `document/schema/(?P<version>\d+)`,
+		Fields: map[string]*framework.FieldSchema{
+			"version": {
+				Type:        framework.TypeInt,
+				Description: `Document version.`,
+			},
+		},
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathReadDocumentSchema,
+		},
+	}
+}
+
+// Lists the document versions targets may be sent.
+func (b *backend) pathReadDocumentSchemas(ctx context.Context, req *logical.Request, data *framework.FieldData) (response *logical.Response, retErr error) {
+	b.Logger().Debug("pathReadDocumentSchemas", "ctx", ctx, "req", req, "data", data)
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"versions": documentVersions,
+			"latest":   latestDocumentVersion,
+		},
+	}, nil
+}
+
+// Publishes the JSON Schema of a document version, returned as the raw HTTP body so
+// targets can feed it straight to a validator.
+func (b *backend) pathReadDocumentSchema(ctx context.Context, req *logical.Request, data *framework.FieldData) (response *logical.Response, retErr error) {
+	b.Logger().Debug("pathReadDocumentSchema", "ctx", ctx, "req", req, "data", data)
+
+	schema, err := documentSchema(data.Get("version").(int))
+	if err != nil {
+		return nil, logical.CodedError(404, err.Error())
+	}
+
+	buf, err := json.Marshal(schema)
+	if err != nil {
+		return nil, errwrap.Wrapf("failed to marshal document schema: {{err}}", err)
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPContentType: "application/schema+json",
+			logical.HTTPRawBody:     buf,
+			logical.HTTPStatusCode:  200,
+		},
+	}, nil
+}
@@ -2,69 +2,409 @@ package webhook
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"time"
 
-	"github.com/SermoDigital/jose/crypto"
 	"github.com/hashicorp/errwrap"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
 )
 
+// jwsKeyPattern builds the pattern for a path addressing a JWS signing key. The key name
+// segment is optional; leaving it out addresses the default key.
+func jwsKeyPattern(prefix, suffix string) string {
+	return prefix + "(/" + framework.GenericNameRegex("key_name") + ")?" + suffix
+}
+
+func jwsKeyNameSchema() *framework.FieldSchema {
+	return &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: `Name of the signing key. Defaults to the default key.`,
+	}
+}
+
+// jwsKeyName returns the key addressed by a request, which is the default key when the
+// optional key name segment was left out of the path.
+func jwsKeyName(data *framework.FieldData) string {
+	if name := data.Get("key_name").(string); name != "" {
+		return name
+	}
+	return defaultJwsKeyName
+}
+
+func pathListJws(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: `config/keys/jws/`,
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathListJwsKeys,
+		},
+	}
+}
+
 func pathFetchJwsCertificate(b *backend) *framework.Path {
 	return &framework.Path{
-		Pattern: `keys/jws/certificate`,
+		Pattern: jwsKeyPattern("keys/jws", "/certificate"),
+		Fields: map[string]*framework.FieldSchema{
+			"key_name": jwsKeyNameSchema(),
+		},
 		Callbacks: map[logical.Operation]framework.OperationFunc{
 			logical.ReadOperation: b.pathReadJwsCertificate,
 		},
 	}
 }
 
+func pathFetchJwks(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: jwsKeyPattern("keys/jws", "/jwks"),
+		Fields: map[string]*framework.FieldSchema{
+			"key_name": jwsKeyNameSchema(),
+		},
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathReadJwks,
+		},
+	}
+}
+
 func pathConfigJws(b *backend) *framework.Path {
 	return &framework.Path{
-		Pattern: `config/keys/jws`,
+		Pattern: jwsKeyPattern("config/keys/jws", ""),
 		Fields: map[string]*framework.FieldSchema{
+			"key_name": jwsKeyNameSchema(),
 			"certificate": {
 				Type:        framework.TypeString,
-				Description: `PEM encoded public certificate`,
+				Description: `PEM encoded public key, or X.509 certificate followed by its chain`,
 			},
 			"private_key": {
 				Type:        framework.TypeString,
 				Description: `PEM encoded private key`,
 			},
+			"passphrase": {
+				Type:        framework.TypeString,
+				Description: `Passphrase private_key is encrypted with, if any. Write only, the key is stored decrypted`,
+			},
+			"algorithm": {
+				Type:        framework.TypeString,
+				Description: `JWS signing algorithm, for example RS512, PS256 or ES256. Chosen from the key type if unset`,
+			},
+			"grace_period": {
+				Type:        framework.TypeDurationSecond,
+				Description: `How long a rotated-out public key stays published`,
+				Default:     int(defaultJwsGracePeriod / time.Second),
+			},
+			"dual_sign": {
+				Type:        framework.TypeBool,
+				Description: `Also sign with rotated-out keys still inside their grace period. Only applies to the general serialization`,
+			},
+			"auto_rotate_period": {
+				Type:        framework.TypeDurationSecond,
+				Description: `How old the current key may get before a new one is generated to replace it. 0 disables automatic rotation`,
+			},
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
 			logical.UpdateOperation: b.pathWriteJwsKeys,
 			logical.CreateOperation: b.pathWriteJwsKeys,
+			logical.ReadOperation:   b.pathReadJwsConfig,
+			logical.DeleteOperation: b.pathDeleteJwsKeys,
 		},
 		//HelpSynopsis:    pathFetchHelpSyn,
 		//HelpDescription: pathFetchHelpDesc,
 	}
 }
 
+func pathRotateJws(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: jwsKeyPattern("config/keys/jws", "/rotate"),
+		Fields: map[string]*framework.FieldSchema{
+			"key_name": jwsKeyNameSchema(),
+			"certificate": {
+				Type:        framework.TypeString,
+				Description: `PEM encoded public key, or X.509 certificate followed by its chain`,
+			},
+			"private_key": {
+				Type:        framework.TypeString,
+				Description: `PEM encoded private key`,
+			},
+			"passphrase": {
+				Type:        framework.TypeString,
+				Description: `Passphrase private_key is encrypted with, if any. Write only, the key is stored decrypted`,
+			},
+			"algorithm": {
+				Type:        framework.TypeString,
+				Description: `JWS signing algorithm, for example RS512, PS256 or ES256. Chosen from the key type if unset`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathRotateJwsKeys,
+		},
+	}
+}
+
+func pathGenerateJws(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: jwsKeyPattern("config/keys/jws", "/generate"),
+		Fields: map[string]*framework.FieldSchema{
+			"key_name": jwsKeyNameSchema(),
+			"key_type": {
+				Type:        framework.TypeLowerCaseString,
+				Description: `Type of key to generate, rsa or ec`,
+				Default:     "rsa",
+			},
+			"key_bits": {
+				Type:        framework.TypeInt,
+				Description: `Size of a generated RSA key in bits, 2048, 3072 or 4096`,
+				Default:     2048,
+			},
+			"curve": {
+				Type:        framework.TypeString,
+				Description: `Curve of a generated EC key, P-256, P-384 or P-521`,
+				Default:     "P-256",
+			},
+			"algorithm": {
+				Type:        framework.TypeString,
+				Description: `JWS signing algorithm, for example RS512, PS256 or ES256. Chosen from the key type if unset`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathGenerateJwsKeys,
+		},
+	}
+}
+
 func (b *backend) pathReadJwsCertificate(ctx context.Context, req *logical.Request, data *framework.FieldData) (response *logical.Response, retErr error) {
 
 	b.Logger().Debug("pathReadJwsCertificate", "ctx", ctx, "req", req, "data", data)
 	b.Lock.RLock()
 	defer b.Lock.RUnlock()
 
-	entry, err := req.Storage.Get(ctx, "config/keys/jws/certificate")
+	ring, err := getJwsKeyRing(ctx, req.Storage, jwsKeyName(data))
 	if err != nil {
 		return nil, errwrap.Wrapf("could not get public certificate: {{err}}", err)
 	}
+	if ring == nil {
+		return nil, logical.CodedError(http.StatusNotFound, fmt.Sprintf("jws key %q is not configured", jwsKeyName(data)))
+	}
+
+	certificates := make(map[string]interface{})
+	keys := make(map[string]interface{})
+	for _, key := range ring.published(time.Now()) {
+		info, err := key.publicInfo()
+		if err != nil {
+			return nil, err
+		}
+		certificates[key.KeyID] = key.Certificate
+		keys[key.KeyID] = info
+	}
+
+	// The current key's details are also returned at the top level, next to the
+	// certificate and kid this path has always returned.
+	resp, err := ring.current().publicInfo()
+	if err != nil {
+		return nil, err
+	}
+	resp["certificates"] = certificates
+	resp["keys"] = keys
+
+	return &logical.Response{
+		Data: resp,
+	}, nil
+}
+
+// Publishes every active public key as an RFC 7517 JWK Set, returned as the raw HTTP body
+// so targets can point stock JOSE libraries straight at this path.
+func (b *backend) pathReadJwks(ctx context.Context, req *logical.Request, data *framework.FieldData) (response *logical.Response, retErr error) {
+	b.Logger().Debug("pathReadJwks", "ctx", ctx, "req", req, "data", data)
+	b.Lock.RLock()
+	defer b.Lock.RUnlock()
+
+	ring, err := getJwsKeyRing(ctx, req.Storage, jwsKeyName(data))
+	if err != nil {
+		return nil, err
+	}
+
+	jwks := jsonWebKeySet{Keys: []*jsonWebKey{}}
+	if ring != nil {
+		for _, key := range ring.published(time.Now()) {
+			pub, err := key.publicKey()
+			if err != nil {
+				return nil, err
+			}
+
+			jwk, err := newJSONWebKey(pub)
+			if err != nil {
+				return nil, err
+			}
+			jwk.KeyID = key.KeyID
+			jwk.Algorithm = key.algorithm()
+			jwk.Use = "sig"
+
+			chain, err := key.certificateChain()
+			if err != nil {
+				return nil, err
+			}
+			if len(chain) > 0 {
+				jwk.X5C = x5c(chain)
+				jwk.X5TS256 = x5tS256(chain[0])
+			}
+
+			jwks.Keys = append(jwks.Keys, jwk)
+		}
+	}
+
+	buf, err := json.Marshal(jwks)
+	if err != nil {
+		return nil, errwrap.Wrapf("failed to marshal jwks: {{err}}", err)
+	}
 
 	return &logical.Response{
 		Data: map[string]interface{}{
-			"certificate": entry.Value,
+			logical.HTTPContentType: "application/json",
+			logical.HTTPRawBody:     buf,
+			logical.HTTPStatusCode:  200,
 		},
 	}, nil
 }
 
+func (b *backend) pathReadJwsConfig(ctx context.Context, req *logical.Request, data *framework.FieldData) (response *logical.Response, retErr error) {
+	b.Logger().Debug("pathReadJwsConfig", "ctx", ctx, "req", req, "data", data)
+	b.Lock.RLock()
+	defer b.Lock.RUnlock()
+
+	ring, err := getJwsKeyRing(ctx, req.Storage, jwsKeyName(data))
+	if err != nil {
+		return nil, err
+	}
+	if ring == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"latest_version":     ring.LatestVersion,
+			"kid":                ring.current().KeyID,
+			"algorithm":          ring.current().algorithm(),
+			"grace_period":       int64(ring.GracePeriod / time.Second),
+			"auto_rotate_period": int64(ring.AutoRotatePeriod / time.Second),
+			"dual_sign":          ring.DualSign,
+		},
+	}, nil
+}
+
+func (b *backend) pathListJwsKeys(ctx context.Context, req *logical.Request, data *framework.FieldData) (response *logical.Response, retErr error) {
+	b.Logger().Debug("pathListJwsKeys", "ctx", ctx, "req", req, "data", data)
+	b.Lock.RLock()
+	defer b.Lock.RUnlock()
+
+	names, err := listJwsKeyRings(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	return logical.ListResponse(names), nil
+}
+
+// Removes a signing key and every one of its versions. Destinations still bound to it will
+// fail until they are given another key.
+func (b *backend) pathDeleteJwsKeys(ctx context.Context, req *logical.Request, data *framework.FieldData) (response *logical.Response, retErr error) {
+	b.Logger().Debug("pathDeleteJwsKeys", "ctx", ctx, "req", req, "data", data)
+	b.Lock.Lock()
+	defer b.Lock.Unlock()
+
+	if err := deleteJwsKeyRing(ctx, req.Storage, jwsKeyName(data)); err != nil {
+		return nil, err
+	}
+	b.invalidate(ctx, jwsKeyRingStoragePath(jwsKeyName(data)))
+
+	return nil, nil
+}
+
+// Stores the initial JWS key pair. Once keys exist they can only be replaced through
+// the rotate and generate paths, but the grace period can still be changed here.
 func (b *backend) pathWriteJwsKeys(ctx context.Context, req *logical.Request, data *framework.FieldData) (response *logical.Response, retErr error) {
 	b.Logger().Debug("pathWriteJwsKeys", "ctx", ctx, "req", req, "data", data)
 	b.Lock.Lock()
 	defer b.Lock.Unlock()
 
+	ring, err := getJwsKeyRing(ctx, req.Storage, jwsKeyName(data))
+	if err != nil {
+		return nil, err
+	}
+
+	certificate, hasCertificate := data.GetOk("certificate")
+	privKey, hasPrivKey := data.GetOk("private_key")
+
+	_, hasPassphrase := data.GetOk("passphrase")
+	_, hasAlgorithm := data.GetOk("algorithm")
+
+	// The key pair, and the algorithm it signs with, only change by rotating to a new one.
+	if ring != nil && (hasCertificate || hasPrivKey || hasPassphrase || hasAlgorithm) {
+		return nil, logical.CodedError(http.StatusBadRequest, fmt.Sprintf("jws key %q is already configured, write the new key pair to %s/rotate to replace it", jwsKeyName(data), req.Path))
+	}
+
+	if ring == nil {
+		if !hasCertificate {
+			return nil, fmt.Errorf("certificate is required")
+		}
+		if !hasPrivKey {
+			return nil, fmt.Errorf("private_key is required")
+		}
+
+		ring = &jwsKeyRing{GracePeriod: defaultJwsGracePeriod}
+		if err := addJwsKey(ring, certificate.(string), privKey.(string), data.Get("passphrase").(string), data.Get("algorithm").(string)); err != nil {
+			return nil, err
+		}
+	}
+
+	if gracePeriod, ok := data.GetOk("grace_period"); ok {
+		ring.GracePeriod = time.Duration(gracePeriod.(int)) * time.Second
+	}
+
+	resp := &logical.Response{}
+
+	if dualSign, ok := data.GetOk("dual_sign"); ok {
+		ring.DualSign = dualSign.(bool)
+		if ring.DualSign {
+			resp.AddWarning("dual_sign only applies to destinations using the general serialization, the others are signed by the current key alone")
+		}
+	}
+
+	if autoRotatePeriod, ok := data.GetOk("auto_rotate_period"); ok {
+		period := time.Duration(autoRotatePeriod.(int)) * time.Second
+		if period != 0 && period < minAutoRotatePeriod {
+			return nil, fmt.Errorf("auto_rotate_period must be 0 or at least %s", minAutoRotatePeriod)
+		}
+		if period == 0 {
+			ring.discardPending()
+		} else {
+			hasCertificate, err := ring.current().hasCertificate()
+			if err != nil {
+				return nil, err
+			}
+			if hasCertificate {
+				return nil, fmt.Errorf("jws key %q is backed by a certificate, which can't be reissued automatically, rotate it manually instead", jwsKeyName(data))
+			}
+		}
+		ring.AutoRotatePeriod = period
+	}
+
+	if err := putJwsKeyRing(ctx, req.Storage, jwsKeyName(data), ring); err != nil {
+		return nil, err
+	}
+	b.invalidate(ctx, jwsKeyRingStoragePath(jwsKeyName(data)))
+	return resp, nil
+}
+
+// Replaces the current JWS key pair. The outgoing public key remains published for the
+// configured grace period so targets can keep verifying documents already in flight.
+func (b *backend) pathRotateJwsKeys(ctx context.Context, req *logical.Request, data *framework.FieldData) (response *logical.Response, retErr error) {
+	b.Logger().Debug("pathRotateJwsKeys", "ctx", ctx, "req", req, "data", data)
+	b.Lock.Lock()
+	defer b.Lock.Unlock()
+
 	certificate, ok := data.GetOk("certificate")
 	if !ok {
 		return nil, fmt.Errorf("certificate is required")
@@ -75,32 +415,106 @@ func (b *backend) pathWriteJwsKeys(ctx context.Context, req *logical.Request, da
 		return nil, fmt.Errorf("private_key is required")
 	}
 
-	certBytes := []byte(certificate.(string))
-	privKeyBytes := []byte(privKey.(string))
+	ring, err := getJwsKeyRing(ctx, req.Storage, jwsKeyName(data))
+	if err != nil {
+		return nil, err
+	}
+	if ring == nil {
+		return nil, fmt.Errorf("jws key %q is not configured yet", jwsKeyName(data))
+	}
 
-	if _, err := crypto.ParseRSAPublicKeyFromPEM(certBytes); err != nil {
-		return nil, errwrap.Wrapf("could not parse certificate: {{err}}", err)
+	if err := addJwsKey(ring, certificate.(string), privKey.(string), data.Get("passphrase").(string), data.Get("algorithm").(string)); err != nil {
+		return nil, err
 	}
 
-	if _, err := crypto.ParseRSAPrivateKeyFromPEM(privKeyBytes); err != nil {
-		return nil, errwrap.Wrapf("could not parse private_key: {{err}}", err)
+	if err := putJwsKeyRing(ctx, req.Storage, jwsKeyName(data), ring); err != nil {
+		return nil, err
 	}
+	b.invalidate(ctx, jwsKeyRingStoragePath(jwsKeyName(data)))
 
-	publicEntry := &logical.StorageEntry{
-		Key:   "config/keys/jws/certificate",
-		Value: certBytes,
+	current := ring.current()
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"version":   current.Version,
+			"kid":       current.KeyID,
+			"algorithm": current.algorithm(),
+		},
+	}, nil
+}
+
+// Generates a key pair inside the backend so the private key never leaves Vault. If keys
+// are already configured this rotates to the generated key. Only the public half is returned.
+func (b *backend) pathGenerateJwsKeys(ctx context.Context, req *logical.Request, data *framework.FieldData) (response *logical.Response, retErr error) {
+	b.Logger().Debug("pathGenerateJwsKeys", "ctx", ctx, "req", req, "data", data)
+	b.Lock.Lock()
+	defer b.Lock.Unlock()
+
+	privKey, certificate, err := generateKeyPair(data.Get("key_type").(string), data.Get("key_bits").(int), data.Get("curve").(string))
+	if err != nil {
+		return nil, err
 	}
 
-	privateEntry := &logical.StorageEntry{
-		Key:   "config/keys/jws/private_key",
-		Value: privKeyBytes,
+	ring, err := getJwsKeyRing(ctx, req.Storage, jwsKeyName(data))
+	if err != nil {
+		return nil, err
+	}
+	if ring == nil {
+		ring = &jwsKeyRing{GracePeriod: defaultJwsGracePeriod}
 	}
 
-	if err := req.Storage.Put(ctx, publicEntry); err != nil {
-		return nil, errwrap.Wrapf("could not store certificate: {{err}}", err)
+	key, err := ring.addKey(certificate, privKey, data.Get("algorithm").(string), time.Now())
+	if err != nil {
+		return nil, err
 	}
-	if err := req.Storage.Put(ctx, privateEntry); err != nil {
-		return nil, errwrap.Wrapf("could not store private_key: {{err}}", err)
+
+	if err := putJwsKeyRing(ctx, req.Storage, jwsKeyName(data), ring); err != nil {
+		return nil, err
 	}
-	return &logical.Response{}, nil
+	b.invalidate(ctx, jwsKeyRingStoragePath(jwsKeyName(data)))
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"version":     key.Version,
+			"kid":         key.KeyID,
+			"algorithm":   key.algorithm(),
+			"certificate": key.Certificate,
+		},
+	}, nil
+}
+
+// addJwsKey validates a PEM key pair supplied by the operator and adds it to the ring. The
+// certificate must belong to the private key, and must not have expired. The private key
+// is decrypted with passphrase if needed and stored unencrypted, relying on seal wrapping.
+func addJwsKey(ring *jwsKeyRing, certificate, privKey, passphrase, algorithm string) error {
+	pub, chain, err := parseCertificatePEM([]byte(certificate))
+	if err != nil {
+		return errwrap.Wrapf("could not parse certificate: {{err}}", err)
+	}
+
+	privKey, err = normalizePrivateKeyPEM([]byte(privKey), passphrase)
+	if err != nil {
+		return errwrap.Wrapf("could not parse private_key: {{err}}", err)
+	}
+
+	signer, err := parsePrivateKeyPEM([]byte(privKey))
+	if err != nil {
+		return errwrap.Wrapf("could not parse private_key: {{err}}", err)
+	}
+
+	if !matchesPrivateKey(pub, signer) {
+		return fmt.Errorf("certificate does not match private_key")
+	}
+
+	// Auto rotation generates bare keys, so it would silently drop the certificate.
+	if len(chain) > 0 && ring.AutoRotatePeriod > 0 {
+		return fmt.Errorf("certificates can't be used while auto_rotate_period is set, disable it first")
+	}
+
+	now := time.Now()
+	if len(chain) > 0 && now.After(chain[0].NotAfter) {
+		return fmt.Errorf("certificate expired at %s", chain[0].NotAfter.Format(time.RFC3339))
+	}
+
+	_, err = ring.addKey(certificate, privKey, algorithm, now)
+	return err
 }
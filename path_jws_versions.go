@@ -0,0 +1,127 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathConfigJwsVersions(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: jwsKeyPattern("config/keys/jws", "/versions/"),
+		Fields: map[string]*framework.FieldSchema{
+			"key_name": jwsKeyNameSchema(),
+		},
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathListJwsVersions,
+		},
+	}
+}
+
+func pathConfigJwsVersion(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: jwsKeyPattern("config/keys/jws", `/versions/(?P<version>\d+)`),
+		Fields: map[string]*framework.FieldSchema{
+			"key_name": jwsKeyNameSchema(),
+			"version": {
+				Type:        framework.TypeInt,
+				Description: `Version of the JWS signing key.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathReadJwsVersion,
+			logical.DeleteOperation: b.pathRetireJwsVersion,
+		},
+	}
+}
+
+func (b *backend) pathListJwsVersions(ctx context.Context, req *logical.Request, data *framework.FieldData) (response *logical.Response, retErr error) {
+	b.Logger().Debug("pathListJwsVersions", "ctx", ctx, "req", req, "data", data)
+	b.Lock.RLock()
+	defer b.Lock.RUnlock()
+
+	ring, err := getJwsKeyRing(ctx, req.Storage, jwsKeyName(data))
+	if err != nil {
+		return nil, err
+	}
+	if ring == nil {
+		return logical.ListResponse(nil), nil
+	}
+
+	var versions []string
+	for _, v := range ring.versions() {
+		versions = append(versions, strconv.Itoa(v))
+	}
+
+	return logical.ListResponse(versions), nil
+}
+
+// Returns the public half and lifecycle of a single key version. The private key is never returned.
+func (b *backend) pathReadJwsVersion(ctx context.Context, req *logical.Request, data *framework.FieldData) (response *logical.Response, retErr error) {
+	b.Logger().Debug("pathReadJwsVersion", "ctx", ctx, "req", req, "data", data)
+	b.Lock.RLock()
+	defer b.Lock.RUnlock()
+
+	ring, err := getJwsKeyRing(ctx, req.Storage, jwsKeyName(data))
+	if err != nil {
+		return nil, err
+	}
+	if ring == nil {
+		return nil, nil
+	}
+
+	key, ok := ring.Keys[data.Get("version").(int)]
+	if !ok {
+		return nil, nil
+	}
+
+	info, err := key.publicInfo()
+	if err != nil {
+		return nil, err
+	}
+	info["current"] = key.Version == ring.LatestVersion
+	info["pending"] = key.Version > ring.LatestVersion
+	info["published"] = key.RetireTime.IsZero() || time.Now().Before(key.RetireTime)
+
+	return &logical.Response{
+		Data: info,
+	}, nil
+}
+
+// Retires a superseded key version immediately: it is no longer published and its
+// private key is removed from storage. The current signing key cannot be retired.
+func (b *backend) pathRetireJwsVersion(ctx context.Context, req *logical.Request, data *framework.FieldData) (response *logical.Response, retErr error) {
+	b.Logger().Debug("pathRetireJwsVersion", "ctx", ctx, "req", req, "data", data)
+	b.Lock.Lock()
+	defer b.Lock.Unlock()
+
+	ring, err := getJwsKeyRing(ctx, req.Storage, jwsKeyName(data))
+	if err != nil {
+		return nil, err
+	}
+	if ring == nil {
+		return nil, nil
+	}
+
+	version := data.Get("version").(int)
+	if version == ring.LatestVersion {
+		return nil, fmt.Errorf("version %d is the current signing key, rotate before retiring it", version)
+	}
+	if _, ok := ring.Keys[version]; !ok {
+		return nil, nil
+	}
+
+	delete(ring.Keys, version)
+
+	if err := putJwsKeyRing(ctx, req.Storage, jwsKeyName(data), ring); err != nil {
+		return nil, err
+	}
+	b.invalidate(ctx, jwsKeyRingStoragePath(jwsKeyName(data)))
+
+	return nil, nil
+}
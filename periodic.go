@@ -0,0 +1,130 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/helper/consts"
+	"github.com/hashicorp/vault/logical"
+)
+
+// minAutoRotatePeriod keeps a typo from rotating keys faster than targets can follow.
+const minAutoRotatePeriod = time.Hour
+
+// periodicFunc is called by Vault's rollback manager, about once a minute.
+func (b *backend) periodicFunc(ctx context.Context, req *logical.Request) error {
+	// Storage on performance secondaries is replicated from the primary, which rotates.
+	if b.System().ReplicationState().HasState(consts.ReplicationPerformanceSecondary) && !b.System().LocalMount() {
+		return nil
+	}
+
+	return b.autoRotateJwsKeys(ctx, req.Storage, time.Now())
+}
+
+// autoRotateJwsKeys replaces every current key older than its ring's auto_rotate_period
+// with a newly generated key of the same type. The new key is published ahead of the
+// rotation, and the replaced key stays published for the ring's grace period, as with a
+// manual rotation.
+func (b *backend) autoRotateJwsKeys(ctx context.Context, s logical.Storage, now time.Time) error {
+	b.Lock.RLock()
+	names, err := listJwsKeyRings(ctx, s)
+	b.Lock.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		// One broken ring must not hold back rotation of the others.
+		if err := b.autoRotateJwsKeyRing(ctx, s, name, now); err != nil {
+			b.Logger().Error("could not rotate jws key", "key_name", name, "error", err)
+		}
+	}
+
+	return nil
+}
+
+// autoRotateJwsKeyRing publishes the next key of the named key ring, or makes it the
+// current key, once either is due. The exclusive lock is only taken to save the ring, so
+// that signing isn't held up on every tick or while a key pair is generated.
+func (b *backend) autoRotateJwsKeyRing(ctx context.Context, s logical.Storage, name string, now time.Time) error {
+	b.Lock.RLock()
+	ring, err := getJwsKeyRing(ctx, s, name)
+	b.Lock.RUnlock()
+	if err != nil {
+		return err
+	}
+	if ring == nil {
+		return nil
+	}
+
+	// Generating a key pair can take a while, so it happens before the lock is taken.
+	var privKey, certificate string
+	if !ring.dueForRotation(now) {
+		if !ring.dueForPublishing(now) {
+			return nil
+		}
+
+		current := ring.current()
+		hasCertificate, err := current.hasCertificate()
+		if err != nil {
+			return err
+		}
+		if hasCertificate {
+			return fmt.Errorf("current key is backed by a certificate, which can't be reissued automatically")
+		}
+
+		pub, err := current.publicKey()
+		if err != nil {
+			return err
+		}
+
+		privKey, certificate, err = generateKeyPairLike(pub)
+		if err != nil {
+			return errwrap.Wrapf("could not generate jws key: {{err}}", err)
+		}
+	}
+
+	b.Lock.Lock()
+	defer b.Lock.Unlock()
+
+	// The ring may have been rotated or replaced while the lock was released.
+	currentKeyID := ring.current().KeyID
+	ring, err = getJwsKeyRing(ctx, s, name)
+	if err != nil {
+		return err
+	}
+	if ring == nil || ring.current().KeyID != currentKeyID {
+		return nil
+	}
+
+	var key *jwsKey
+	switch {
+	case privKey == "" && ring.dueForRotation(now):
+		ring.activatePending(now)
+		key = ring.current()
+
+	case privKey != "" && ring.dueForPublishing(now):
+		key, err = ring.stageKey(certificate, privKey, ring.current().algorithm(), now)
+		if err != nil {
+			return err
+		}
+
+	default:
+		return nil
+	}
+
+	if err := putJwsKeyRing(ctx, s, name, ring); err != nil {
+		return err
+	}
+	b.invalidate(ctx, jwsKeyRingStoragePath(name))
+
+	if key.Version == ring.LatestVersion {
+		b.Logger().Info("rotated jws key", "key_name", name, "version", key.Version, "kid", key.KeyID)
+	} else {
+		b.Logger().Info("published next jws key", "key_name", name, "version", key.Version, "kid", key.KeyID)
+	}
+
+	return nil
+}
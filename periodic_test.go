@@ -0,0 +1,110 @@
+package webhook
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+func TestAutoRotateJwsKeyRing(t *testing.T) {
+	ctx := context.Background()
+	b := Backend()
+	s := &logical.InmemStorage{}
+
+	ring := newTestJwsKeyRing(t, 2*time.Hour, 24*time.Hour)
+	first := ring.current().KeyID
+	if err := putJwsKeyRing(ctx, s, "named", ring); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each tick is checked against the ring it leaves in storage.
+	for _, tc := range []struct {
+		name          string
+		now           time.Duration
+		latestVersion int
+		keys          int
+	}{
+		{"before publishing ahead", 59 * time.Minute, 1, 1},
+		{"publishing ahead", time.Hour, 1, 2},
+		{"waiting for the period", 90 * time.Minute, 1, 2},
+		{"rotating", 2 * time.Hour, 2, 2},
+		// The new key's age counts from its publication, an hour before it became current.
+		{"publishing the next key", 2*time.Hour + time.Minute, 2, 3},
+	} {
+		if err := b.autoRotateJwsKeyRing(ctx, s, "named", testRotationStart.Add(tc.now)); err != nil {
+			t.Fatalf("%s: %s", tc.name, err)
+		}
+
+		ring, err := getJwsKeyRing(ctx, s, "named")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ring.LatestVersion != tc.latestVersion || len(ring.Keys) != tc.keys {
+			t.Fatalf("%s: got latest version %d of %d keys, want %d of %d", tc.name, ring.LatestVersion, len(ring.Keys), tc.latestVersion, tc.keys)
+		}
+	}
+
+	parsed, err := b.getSigningKeys(ctx, s, "named")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.current().kid == first {
+		t.Error("still signing with the replaced key")
+	}
+}
+
+func TestAutoRotateSkipsCertificateBackedKey(t *testing.T) {
+	ctx := context.Background()
+	b := Backend()
+	s := &logical.InmemStorage{}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "webhook"},
+		NotBefore:    testRotationStart,
+		NotAfter:     testRotationStart.Add(365 * 24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ring := &jwsKeyRing{AutoRotatePeriod: 2 * time.Hour, GracePeriod: 24 * time.Hour}
+	certificate := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	privKey := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: privDer})
+	if _, err := ring.addKey(string(certificate), string(privKey), "ES256", testRotationStart); err != nil {
+		t.Fatal(err)
+	}
+	if err := putJwsKeyRing(ctx, s, "named", ring); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.autoRotateJwsKeyRing(ctx, s, "named", testRotationStart.Add(3*time.Hour)); err == nil {
+		t.Fatal("expected an error rotating a certificate backed key")
+	}
+
+	ring, err = getJwsKeyRing(ctx, s, "named")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ring.LatestVersion != 1 || len(ring.Keys) != 1 {
+		t.Errorf("certificate backed key was rotated: latest version %d of %d keys", ring.LatestVersion, len(ring.Keys))
+	}
+}
@@ -0,0 +1,61 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/pem"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The keys in testdata/pkcs8 were encrypted by OpenSSL 3.0 from key.pem with
+// "openssl pkcs8 -topk8 -v2 <cipher> -v2prf <prf> -passout pass:correct-horse".
+const testPKCS8Passphrase = "correct-horse"
+
+func readTestPEM(t *testing.T, name string) *pem.Block {
+	buf, err := ioutil.ReadFile(filepath.Join("testdata", "pkcs8", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(buf)
+	if block == nil {
+		t.Fatalf("%s is not PEM encoded", name)
+	}
+	return block
+}
+
+func TestDecryptPKCS8(t *testing.T) {
+	want := readTestPEM(t, "key.pem").Bytes
+
+	for _, name := range []string{
+		"aes128-hmacWithSHA1.pem",
+		"aes192-hmacWithSHA384.pem",
+		"aes256-hmacWithSHA256.pem",
+		"des3-hmacWithSHA512.pem",
+	} {
+		block := readTestPEM(t, name)
+
+		got, err := decryptPKCS8(block.Bytes, testPKCS8Passphrase)
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+			continue
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: decrypted key does not match key.pem", name)
+		}
+
+		if _, err := decryptPKCS8(block.Bytes, "wrong-horse"); err == nil {
+			t.Errorf("%s: decrypted with the wrong passphrase", name)
+		}
+	}
+}
+
+func TestDecryptPKCS8IterationLimit(t *testing.T) {
+	block := readTestPEM(t, "aes256-2000000-iterations.pem")
+
+	_, err := decryptPKCS8(block.Bytes, testPKCS8Passphrase)
+	if err == nil || !strings.Contains(err.Error(), "iteration count") {
+		t.Fatalf("expected the iteration count to be refused, got %v", err)
+	}
+}
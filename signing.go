@@ -0,0 +1,407 @@
+package webhook
+
+import (
+	gocrypto "crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/SermoDigital/jose/crypto"
+	"github.com/hashicorp/errwrap"
+)
+
+// defaultRSAAlgorithm is what RSA keys sign with when no algorithm is configured, and
+// what every key signed with before the algorithm was selectable.
+const defaultRSAAlgorithm = "RS512"
+
+// jwsSigningMethods are the JWS algorithms a signing key can be configured with.
+var jwsSigningMethods = map[string]crypto.SigningMethod{
+	"RS256": crypto.SigningMethodRS256,
+	"RS384": crypto.SigningMethodRS384,
+	"RS512": crypto.SigningMethodRS512,
+
+	"PS256": newRSAPSSSigningMethod("PS256", gocrypto.SHA256),
+	"PS384": newRSAPSSSigningMethod("PS384", gocrypto.SHA384),
+	"PS512": newRSAPSSSigningMethod("PS512", gocrypto.SHA512),
+
+	"ES256": &ecdsaSigningMethod{crypto.SigningMethodES256, elliptic.P256()},
+	"ES384": &ecdsaSigningMethod{crypto.SigningMethodES384, elliptic.P384()},
+	"ES512": &ecdsaSigningMethod{crypto.SigningMethodES512, elliptic.P521()},
+}
+
+// newRSAPSSSigningMethod builds an RSA-PSS signing method using a salt as long as the hash,
+// as RFC 7518 section 3.5 requires. The vendored PS methods use the longest salt possible,
+// which strict verifiers reject.
+func newRSAPSSSigningMethod(name string, hash gocrypto.Hash) crypto.SigningMethod {
+	return &crypto.SigningMethodRSAPSS{
+		SigningMethodRSA: &crypto.SigningMethodRSA{
+			Name: name,
+			Hash: hash,
+		},
+		Options: &rsa.PSSOptions{
+			SaltLength: rsa.PSSSaltLengthEqualsHash,
+			Hash:       hash,
+		},
+	}
+}
+
+// ecdsaSigningMethod wraps the vendored ECDSA signing methods, which produce ASN.1 DER
+// signatures, to use the fixed width R || S encoding required by RFC 7518 section 3.4.
+type ecdsaSigningMethod struct {
+	*crypto.SigningMethodECDSA
+	curve elliptic.Curve
+}
+
+// Sign implements crypto.SigningMethod. key must be an *ecdsa.PrivateKey on the method's curve.
+func (m *ecdsaSigningMethod) Sign(raw []byte, key interface{}) (crypto.Signature, error) {
+	ecKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok || ecKey.Curve != m.curve {
+		return nil, crypto.ErrInvalidKey
+	}
+
+	r, s, err := ecdsa.Sign(rand.Reader, ecKey, m.sum(raw))
+	if err != nil {
+		return nil, err
+	}
+
+	size := m.size()
+	sig := make([]byte, 2*size)
+	rBytes, sBytes := r.Bytes(), s.Bytes()
+	copy(sig[size-len(rBytes):size], rBytes)
+	copy(sig[2*size-len(sBytes):], sBytes)
+
+	return crypto.Signature(sig), nil
+}
+
+// Verify implements crypto.SigningMethod. key must be an *ecdsa.PublicKey on the method's curve.
+func (m *ecdsaSigningMethod) Verify(raw []byte, sig crypto.Signature, key interface{}) error {
+	ecKey, ok := key.(*ecdsa.PublicKey)
+	if !ok || ecKey.Curve != m.curve {
+		return crypto.ErrInvalidKey
+	}
+
+	size := m.size()
+	if len(sig) != 2*size {
+		return crypto.ErrECDSAVerification
+	}
+
+	r := new(big.Int).SetBytes(sig[:size])
+	s := new(big.Int).SetBytes(sig[size:])
+	if !ecdsa.Verify(ecKey, m.sum(raw), r, s) {
+		return crypto.ErrECDSAVerification
+	}
+	return nil
+}
+
+func (m *ecdsaSigningMethod) sum(raw []byte) []byte {
+	h := m.Hash.New()
+	h.Write(raw)
+	return h.Sum(nil)
+}
+
+// size is the width in bytes of each of R and S.
+func (m *ecdsaSigningMethod) size() int {
+	return (m.curve.Params().BitSize + 7) / 8
+}
+
+// supportedAlgorithms lists the names in jwsSigningMethods, for error messages.
+func supportedAlgorithms() []string {
+	var algs []string
+	for alg := range jwsSigningMethods {
+		algs = append(algs, alg)
+	}
+	sort.Strings(algs)
+	return algs
+}
+
+// defaultAlgorithm picks the algorithm for a key when the operator did not ask for one.
+func defaultAlgorithm(pub interface{}) (string, error) {
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		return defaultRSAAlgorithm, nil
+	case *ecdsa.PublicKey:
+		for _, alg := range []string{"ES256", "ES384", "ES512"} {
+			if jwsSigningMethods[alg].(*ecdsaSigningMethod).curve == key.Curve {
+				return alg, nil
+			}
+		}
+		return "", fmt.Errorf("unsupported elliptic curve %s", key.Curve.Params().Name)
+	default:
+		return "", fmt.Errorf("unsupported public key type %T", pub)
+	}
+}
+
+// validateAlgorithm checks that a key can be used with the named algorithm.
+func validateAlgorithm(alg string, pub interface{}) error {
+	method, ok := jwsSigningMethods[alg]
+	if !ok {
+		return fmt.Errorf("unsupported algorithm %q, must be one of %v", alg, supportedAlgorithms())
+	}
+
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		if _, ok := method.(*ecdsaSigningMethod); ok {
+			return fmt.Errorf("algorithm %s requires an EC key, got an RSA key", alg)
+		}
+	case *ecdsa.PublicKey:
+		ecMethod, ok := method.(*ecdsaSigningMethod)
+		if !ok {
+			return fmt.Errorf("algorithm %s requires an RSA key, got an EC key", alg)
+		}
+		if ecMethod.curve != key.Curve {
+			return fmt.Errorf("algorithm %s requires curve %s, got %s", alg, ecMethod.curve.Params().Name, key.Curve.Params().Name)
+		}
+	default:
+		return fmt.Errorf("unsupported public key type %T", pub)
+	}
+
+	return nil
+}
+
+// generateKeyPair creates a new RSA or EC signing key and returns the PEM encoded private
+// key and PKIX public key.
+func generateKeyPair(keyType string, keyBits int, curve string) (string, string, error) {
+	var privKey gocrypto.Signer
+	var privBlock *pem.Block
+
+	switch keyType {
+	case "rsa":
+		switch keyBits {
+		case 2048, 3072, 4096:
+		default:
+			return "", "", fmt.Errorf("key_bits must be 2048, 3072 or 4096, got %d", keyBits)
+		}
+		key, err := rsa.GenerateKey(rand.Reader, keyBits)
+		if err != nil {
+			return "", "", errwrap.Wrapf("could not generate RSA key: {{err}}", err)
+		}
+		privKey = key
+		privBlock = &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}
+	case "ec":
+		var c elliptic.Curve
+		switch curve {
+		case "P-256":
+			c = elliptic.P256()
+		case "P-384":
+			c = elliptic.P384()
+		case "P-521":
+			c = elliptic.P521()
+		default:
+			return "", "", fmt.Errorf("unsupported curve %q, must be one of P-256, P-384 or P-521", curve)
+		}
+		key, err := ecdsa.GenerateKey(c, rand.Reader)
+		if err != nil {
+			return "", "", errwrap.Wrapf("could not generate EC key: {{err}}", err)
+		}
+		der, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return "", "", errwrap.Wrapf("could not marshal EC key: {{err}}", err)
+		}
+		privKey = key
+		privBlock = &pem.Block{Type: "EC PRIVATE KEY", Bytes: der}
+	default:
+		return "", "", fmt.Errorf("unsupported key_type %q, must be rsa or ec", keyType)
+	}
+
+	pubDer, err := x509.MarshalPKIXPublicKey(privKey.Public())
+	if err != nil {
+		return "", "", errwrap.Wrapf("could not marshal public key: {{err}}", err)
+	}
+
+	privPEM := pem.EncodeToMemory(privBlock)
+	pubPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDer})
+
+	return string(privPEM), string(pubPEM), nil
+}
+
+// parsePrivateKeyPEM parses a PEM encoded PKCS#1 RSA, SEC 1 EC or PKCS#8 private key.
+func parsePrivateKeyPEM(pemBytes []byte) (gocrypto.Signer, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, crypto.ErrKeyMustBePEMEncoded
+	}
+
+	return parsePrivateKeyDER(block.Bytes)
+}
+
+func parsePrivateKeyDER(der []byte) (gocrypto.Signer, error) {
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		switch key := key.(type) {
+		case *rsa.PrivateKey:
+			return key, nil
+		case *ecdsa.PrivateKey:
+			return key, nil
+		default:
+			return nil, fmt.Errorf("unsupported private key type %T, must be RSA or EC", key)
+		}
+	}
+
+	return nil, fmt.Errorf("private key is not a PKCS#1 RSA, EC or PKCS#8 key")
+}
+
+// normalizePrivateKeyPEM decrypts and re-encodes a private key supplied by an operator, so
+// that it is stored as an unencrypted PKCS#1 RSA or SEC 1 EC key. Keys may be PKCS#1, SEC 1
+// or PKCS#8, and may be encrypted with passphrase, either as an encrypted PKCS#8 key or
+// with the legacy OpenSSL PEM encryption.
+func normalizePrivateKeyPEM(pemBytes []byte, passphrase string) (string, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return "", crypto.ErrKeyMustBePEMEncoded
+	}
+
+	der := block.Bytes
+	switch {
+	case block.Type == "ENCRYPTED PRIVATE KEY":
+		if passphrase == "" {
+			return "", fmt.Errorf("private key is encrypted, passphrase is required")
+		}
+		decrypted, err := decryptPKCS8(der, passphrase)
+		if err != nil {
+			return "", err
+		}
+		der = decrypted
+	case x509.IsEncryptedPEMBlock(block):
+		if passphrase == "" {
+			return "", fmt.Errorf("private key is encrypted, passphrase is required")
+		}
+		decrypted, err := x509.DecryptPEMBlock(block, []byte(passphrase))
+		if err != nil {
+			return "", errPrivateKeyPassphrase
+		}
+		der = decrypted
+	}
+
+	key, err := parsePrivateKeyDER(der)
+	if err != nil {
+		return "", err
+	}
+
+	var normalized *pem.Block
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		normalized = &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}
+	case *ecdsa.PrivateKey:
+		ecDer, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return "", errwrap.Wrapf("could not marshal EC key: {{err}}", err)
+		}
+		normalized = &pem.Block{Type: "EC PRIVATE KEY", Bytes: ecDer}
+	}
+
+	return string(pem.EncodeToMemory(normalized)), nil
+}
+
+// parsePublicKeyPEM parses a PEM encoded PKIX public key or certificate.
+func parsePublicKeyPEM(pemBytes []byte) (interface{}, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, crypto.ErrKeyMustBePEMEncoded
+	}
+
+	if pub, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+		return pub, nil
+	}
+
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, errwrap.Wrapf("neither a public key nor a certificate: {{err}}", err)
+	}
+	return cert.PublicKey, nil
+}
+
+// parseCertificatePEM parses the certificate of a signing key, which is either a bare PKIX
+// public key or an X.509 certificate followed by any intermediate certificates of its chain,
+// leaf first. The chain is nil for a bare public key.
+func parseCertificatePEM(pemBytes []byte) (interface{}, []*x509.Certificate, error) {
+	block, rest := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, nil, crypto.ErrKeyMustBePEMEncoded
+	}
+
+	if pub, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+		return pub, nil, nil
+	}
+
+	var chain []*x509.Certificate
+	for block != nil {
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, nil, errwrap.Wrapf("neither a public key nor a certificate: {{err}}", err)
+		}
+		chain = append(chain, cert)
+		block, rest = pem.Decode(rest)
+	}
+
+	for i := 0; i < len(chain)-1; i++ {
+		if err := chain[i].CheckSignatureFrom(chain[i+1]); err != nil {
+			return nil, nil, fmt.Errorf("certificate %d of the chain (%s) is not issued by the next one (%s)", i, chain[i].Subject, chain[i+1].Subject)
+		}
+	}
+
+	return chain[0].PublicKey, chain, nil
+}
+
+// matchesPrivateKey reports whether pub is the public half of privKey.
+func matchesPrivateKey(pub interface{}, privKey gocrypto.Signer) bool {
+	key, ok := privKey.Public().(interface {
+		Equal(gocrypto.PublicKey) bool
+	})
+	return ok && key.Equal(pub)
+}
+
+// generateKeyPairLike creates a new key pair of the same type and size as pub.
+func generateKeyPairLike(pub interface{}) (string, string, error) {
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		return generateKeyPair("rsa", key.N.BitLen(), "")
+	case *ecdsa.PublicKey:
+		return generateKeyPair("ec", 0, key.Curve.Params().Name)
+	default:
+		return "", "", fmt.Errorf("unsupported public key type %T", pub)
+	}
+}
+
+// describePublicKey returns the type of a public key and its size in bits, along with the
+// curve of an EC key.
+func describePublicKey(pub interface{}) (keyType string, bits int, curve string, err error) {
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		return "rsa", key.N.BitLen(), "", nil
+	case *ecdsa.PublicKey:
+		return "ec", key.Curve.Params().BitSize, key.Curve.Params().Name, nil
+	default:
+		return "", 0, "", fmt.Errorf("unsupported public key type %T", pub)
+	}
+}
+
+// publicKeyFingerprint is the SHA-256 digest of the DER encoded SubjectPublicKeyInfo, as
+// colon separated hex.
+func publicKeyFingerprint(pub interface{}) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", errwrap.Wrapf("could not marshal public key: {{err}}", err)
+	}
+
+	sum := sha256.Sum256(der)
+	hexBytes := make([]string, len(sum))
+	for i, b := range sum {
+		hexBytes[i] = fmt.Sprintf("%02x", b)
+	}
+	return strings.Join(hexBytes, ":"), nil
+}
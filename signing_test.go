@@ -0,0 +1,96 @@
+package webhook
+
+import (
+	gocrypto "crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+	"testing"
+)
+
+func TestRSAPSSSignaturesVerifyWithStrictSaltLength(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := []byte("eyJhbGciOiJQUzI1NiJ9.eyJub25jZSI6Im4ifQ")
+
+	for alg, hash := range map[string]gocrypto.Hash{"PS256": gocrypto.SHA256, "PS384": gocrypto.SHA384, "PS512": gocrypto.SHA512} {
+		sig, err := jwsSigningMethods[alg].Sign(raw, key)
+		if err != nil {
+			t.Fatalf("%s: %s", alg, err)
+		}
+
+		h := hash.New()
+		h.Write(raw)
+
+		// RFC 7518 section 3.5 fixes the salt length to the hash length.
+		opts := &rsa.PSSOptions{SaltLength: hash.Size(), Hash: hash}
+		if err := rsa.VerifyPSS(&key.PublicKey, hash, h.Sum(nil), sig, opts); err != nil {
+			t.Errorf("%s: %s", alg, err)
+		}
+	}
+}
+
+func TestECDSASignaturesAreRS(t *testing.T) {
+	raw := []byte("eyJhbGciOiJFUzI1NiJ9.eyJub25jZSI6Im4ifQ")
+
+	for alg, curve := range map[string]elliptic.Curve{"ES256": elliptic.P256(), "ES384": elliptic.P384(), "ES512": elliptic.P521()} {
+		key, err := ecdsa.GenerateKey(curve, rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		method := jwsSigningMethods[alg].(*ecdsaSigningMethod)
+
+		sig, err := method.Sign(raw, key)
+		if err != nil {
+			t.Fatalf("%s: %s", alg, err)
+		}
+
+		size := (curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			t.Fatalf("%s: expected a %d byte signature, got %d", alg, 2*size, len(sig))
+		}
+
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(&key.PublicKey, method.sum(raw), r, s) {
+			t.Errorf("%s: signature does not verify", alg)
+		}
+
+		if err := method.Verify(raw, sig, &key.PublicKey); err != nil {
+			t.Errorf("%s: %s", alg, err)
+		}
+		sig[0] ^= 0xff
+		if err := method.Verify(raw, sig, &key.PublicKey); err == nil {
+			t.Errorf("%s: tampered signature verified", alg)
+		}
+	}
+}
+
+// TestECDSAVerifiesRFC7515Example checks the ES256 example of RFC 7515 appendix A.3.
+func TestECDSAVerifiesRFC7515Example(t *testing.T) {
+	decode := func(s string) []byte {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	key := &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(decode("f83OJ3D2xF1Bg8vub9tLe1gHMzV76e8Tus9uPHvRVEU")),
+		Y:     new(big.Int).SetBytes(decode("x_FEzRu9m36HLN_tue659LNpXW6pCyStikYjKIWI5a0")),
+	}
+	raw := []byte("eyJhbGciOiJFUzI1NiJ9" +
+		".eyJpc3MiOiJqb2UiLA0KICJleHAiOjEzMDA4MTkzODAsDQogImh0dHA6Ly9leGFtcGxlLmNvbS9pc19yb290Ijp0cnVlfQ")
+	sig := decode("DtEhU3ljbEg8L38VWAfUAqOyKAM6-Xx-F4GawxaepmXFCgfTjDxw5djxLa8ISlSApmWQxfKTUJqPP3-Kg6NU1Q")
+
+	if err := jwsSigningMethods["ES256"].Verify(raw, sig, key); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -13,7 +13,7 @@ import (
 	"github.com/hashicorp/errwrap"
 )
 
-func sendRequest(url string, body []byte, followRedirects bool, timeout time.Duration, cert []byte) ([]byte, error) {
+func sendRequest(url string, body []byte, headers http.Header, followRedirects bool, timeout time.Duration, cert []byte) ([]byte, error) {
 
 	var tlsConfig *tls.Config
 
@@ -52,6 +52,11 @@ func sendRequest(url string, body []byte, followRedirects bool, timeout time.Dur
 	if err != nil {
 		return nil, errwrap.Wrapf("error making request: {{err}}", err)
 	}
+	for name, values := range headers {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
 
 	resp, err := client.Do(req)
 	if err != nil {
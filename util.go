@@ -1,6 +1,7 @@
 package webhook
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 
@@ -12,10 +13,27 @@ import (
 func entryToDestination(entry *logical.StorageEntry) (*Destination, error) {
 	var d Destination
 
-	if err := json.Unmarshal(entry.Value, &d); err != nil {
+	// Parameter schemas hold JSON values, whose numbers must stay json.Number.
+	decoder := json.NewDecoder(bytes.NewReader(entry.Value))
+	decoder.UseNumber()
+	if err := decoder.Decode(&d); err != nil {
 		return nil, errwrap.Wrapf("failed to unmarshal destination: {{err}}", err)
 	}
 
+	if d.BodyTemplate != "" {
+		tmpl, err := parseBodyTemplate(d.BodyTemplate)
+		if err != nil {
+			return nil, errwrap.Wrapf("invalid body_template: {{err}}", err)
+		}
+		d.bodyTemplate = tmpl
+	}
+
+	for name, schema := range d.ParamSchema {
+		if err := schema.compile(); err != nil {
+			return nil, errwrap.Wrapf(fmt.Sprintf("invalid schema for parameter %q: {{err}}", name), err)
+		}
+	}
+
 	return &d, nil
 }
 